@@ -0,0 +1,86 @@
+package bench
+
+import (
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestObjectiveMinima(t *testing.T) {
+	for _, objective := range Objectives(5) {
+		optimum := []float32{0, 0, 0, 0, 0}
+		if objective.Name == "rosenbrock" {
+			optimum = []float32{1, 1, 1, 1, 1}
+		}
+		s := op.NewScope()
+		loss := objective.Model.Loss(s, []tf.Output{op.Const(s.SubScope("x"), optimum)})
+		graph, err := s.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess, err := tf.NewSession(graph, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := sess.Run(nil, []tf.Output{loss}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Close()
+		if value := results[0].Value().(float32); value > 1e-4 || value < -1e-4 {
+			t.Fatal(objective.Name, "loss at the optimum is", value)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := Table([]Result{
+		Result{Objective: "sphere", Optimizer: "a", Generations: 3},
+		Result{Objective: "sphere", Optimizer: "b", Generations: -1, Loss: 0.5},
+	})
+	expected := "objective  a  b\nsphere     3  - (0.5)\n"
+	if table != expected {
+		t.Fatalf("expected %q, got %q", expected, table)
+	}
+}
+
+func TestBench(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the benchmark suite in short mode")
+	}
+	results, err := RunAll(Objectives(5), Optimizers(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + Table(results))
+	// the budgets of the optimizers which should reliably solve an objective are several times what they take, so only a regression fails them.
+	budgets := map[[2]string]int64{
+		{"sphere", "gradient"}:         200,
+		{"sphere", "cmaes"}:            500,
+		{"sphere", "weighted_seed_sm"}: 500,
+		{"sphere", "seed_sm"}:          1000,
+		{"ill_conditioned", "cmaes"}:   1000,
+	}
+	for _, result := range results {
+		budget, ok := budgets[[2]string{result.Objective, result.Optimizer}]
+		if !ok {
+			continue
+		}
+		if result.Generations < 0 || result.Generations > budget {
+			t.Errorf("%s took %d generations on %s, more than its budget of %d; final loss %g", result.Optimizer, result.Generations, result.Objective, budget, result.Loss)
+		}
+	}
+}
+
+func TestRunStopsAtThreshold(t *testing.T) {
+	objective := Sphere(2)
+	objective.Threshold = 2 // already below it at the start, so it is reached after the first step.
+	result, err := Run(objective, Gradient(0.01), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Generations != 1 {
+		t.Fatal("expected 1 generation, got", result.Generations)
+	}
+}
@@ -0,0 +1,134 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// Optimizer builds one of the optimizers of descend for a model.
+type Optimizer struct {
+	Name string
+	Make func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output)
+}
+
+// Result is how one optimizer did on one objective.
+type Result struct {
+	Objective   string
+	Optimizer   string
+	Generations int64   // how many generations it took to reach the threshold. -1 if it never did.
+	Loss        float32 // the loss when it stopped.
+}
+
+// Run steps optimizer on objective until the loss reaches the threshold, or for at most maxGenerations.
+func Run(objective Objective, optimizer Optimizer, maxGenerations int64) (result Result, err error) {
+	result = Result{Objective: objective.Name, Optimizer: optimizer.Name, Generations: -1}
+	s := op.NewScope()
+	makeOptimizer, params := optimizer.Make(s.SubScope("optimizer"), objective.Model)
+	loss := objective.Model.Loss(s.SubScope("bench_loss"), params)
+	graph, err := s.Finalize()
+	if err != nil {
+		return
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		return
+	}
+	opt, err := makeOptimizer(sess)
+	if err != nil {
+		sess.Close()
+		return
+	}
+	defer opt.Close()
+	readLoss := func() (err error) {
+		results, err := sess.Run(nil, []tf.Output{loss}, nil)
+		if err != nil {
+			return
+		}
+		result.Loss = results[0].Value().(float32)
+		return
+	}
+	err = readLoss()
+	if err != nil {
+		return
+	}
+	for generation := int64(1); generation <= maxGenerations; generation++ {
+		err = opt.Step()
+		if err != nil {
+			return
+		}
+		err = readLoss()
+		if err != nil {
+			return
+		}
+		if result.Loss <= objective.Threshold {
+			result.Generations = generation
+			return
+		}
+	}
+	return
+}
+
+// RunAll runs every optimizer on every objective.
+func RunAll(objectives []Objective, optimizers []Optimizer, maxGenerations int64) (results []Result, err error) {
+	for _, objective := range objectives {
+		for _, optimizer := range optimizers {
+			var result Result
+			result, err = Run(objective, optimizer, maxGenerations)
+			if err != nil {
+				err = fmt.Errorf("bench: %s on %s: %v", optimizer.Name, objective.Name, err)
+				return
+			}
+			results = append(results, result)
+		}
+	}
+	return
+}
+
+// Table formats results as a table with a row for each objective and a column for each optimizer.
+// Each cell is the generations to the threshold, or a dash and the final loss if it was never reached.
+func Table(results []Result) string {
+	objectives := []string{}
+	optimizers := []string{}
+	cells := map[[2]string]Result{}
+	seen := map[string]bool{}
+	for _, result := range results {
+		if !seen["objective/"+result.Objective] {
+			seen["objective/"+result.Objective] = true
+			objectives = append(objectives, result.Objective)
+		}
+		if !seen["optimizer/"+result.Optimizer] {
+			seen["optimizer/"+result.Optimizer] = true
+			optimizers = append(optimizers, result.Optimizer)
+		}
+		cells[[2]string{result.Objective, result.Optimizer}] = result
+	}
+	buf := bytes.Buffer{}
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "objective")
+	for _, optimizer := range optimizers {
+		fmt.Fprint(w, "\t", optimizer)
+	}
+	fmt.Fprintln(w)
+	for _, objective := range objectives {
+		fmt.Fprint(w, objective)
+		for _, optimizer := range optimizers {
+			result, ok := cells[[2]string{objective, optimizer}]
+			switch {
+			case !ok:
+				fmt.Fprint(w, "\t")
+			case result.Generations < 0:
+				fmt.Fprintf(w, "\t- (%.3g)", result.Loss)
+			default:
+				fmt.Fprintf(w, "\t%d", result.Generations)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
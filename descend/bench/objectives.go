@@ -0,0 +1,146 @@
+// Package bench provides analytic objectives on which to compare the optimizers of descend, and a harness which reports how many generations each takes to reach a threshold.
+// Unlike MNIST, they need no data and take seconds, so regressions show up in go test.
+package bench
+
+import (
+	"math"
+
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// Objective is a model with a known minimum of 0, and the loss below which it counts as solved.
+type Objective struct {
+	Name      string
+	Model     descend.ModelDef // has one param, "x", a vector which starts away from the minimum.
+	Threshold float32
+}
+
+// vector returns a param def of a vector of dims which all start at start.
+func vector(dims int, start float32) []descend.ParamDef {
+	return []descend.ParamDef{
+		descend.ParamDef{Name: "x", Init: func(s *op.Scope) tf.Output {
+			return op.Fill(s, op.Const(s.SubScope("dims"), []int32{int32(dims)}), op.Const(s.SubScope("start"), start))
+		}},
+	}
+}
+
+// sum adds up the elements of a vector.
+func sum(s *op.Scope, x tf.Output) tf.Output {
+	return op.Sum(s, x, op.Const(s.SubScope("reduction_indices"), []int32{0}))
+}
+
+// mean averages the elements of a vector.
+func mean(s *op.Scope, x tf.Output) tf.Output {
+	return op.Mean(s, x, op.Const(s.SubScope("reduction_indices"), []int32{0}))
+}
+
+// Sphere is the sum of the squares of x, which starts at 1. It is the easiest objective; anything which fails on it is broken.
+func Sphere(dims int) Objective {
+	return Objective{
+		Name: "sphere",
+		Model: descend.ModelDef{
+			Params: vector(dims, 1),
+			Loss: func(s *op.Scope, params []tf.Output) tf.Output {
+				return sum(s, op.Square(s, params[0]))
+			},
+		},
+		Threshold: 0.01,
+	}
+}
+
+// IllConditioned is a quadratic whose curvature grows by a factor of condition from the first dimension to the last. x starts at 1.
+// Optimizers which do not adapt the scale of each dimension must take small steps to not diverge in the steepest.
+func IllConditioned(dims int, condition float64) Objective {
+	scales := make([]float32, dims)
+	for i := range scales {
+		scales[i] = float32(math.Pow(condition, float64(i)/float64(dims-1)))
+	}
+	return Objective{
+		Name: "ill_conditioned",
+		Model: descend.ModelDef{
+			Params: vector(dims, 1),
+			Loss: func(s *op.Scope, params []tf.Output) tf.Output {
+				return sum(s, op.Mul(s, op.Const(s.SubScope("scales"), scales), op.Square(s, params[0])))
+			},
+		},
+		Threshold: 0.01,
+	}
+}
+
+// Rosenbrock is the banana shaped valley, whose minimum is at x = 1. x starts at 0.
+// The valley is easy to find but hard to follow.
+func Rosenbrock(dims int) Objective {
+	// head and tail select all but the last and all but the first elements of x, using only ops with gradients.
+	head := make([][]float32, dims-1)
+	tail := make([][]float32, dims-1)
+	for i := range head {
+		head[i] = make([]float32, dims)
+		head[i][i] = 1
+		tail[i] = make([]float32, dims)
+		tail[i][i+1] = 1
+	}
+	return Objective{
+		Name: "rosenbrock",
+		Model: descend.ModelDef{
+			Params: vector(dims, 0),
+			Loss: func(s *op.Scope, params []tf.Output) tf.Output {
+				reduction := op.Const(s.SubScope("reduction_indices"), []int32{1})
+				x := params[0]
+				xHead := op.Sum(s.SubScope("head"), op.Mul(s, op.Const(s.SubScope("head_select"), head), x), reduction)
+				xTail := op.Sum(s.SubScope("tail"), op.Mul(s, op.Const(s.SubScope("tail_select"), tail), x), reduction)
+				valley := op.Mul(s, op.Const(s.SubScope("hundred"), float32(100)), op.Square(s, op.Sub(s, xTail, op.Square(s, xHead))))
+				return sum(s, op.Add(s, valley, op.Square(s, op.Sub(s, op.Const(s.SubScope("one"), float32(1)), xHead))))
+			},
+		},
+		Threshold: 0.1,
+	}
+}
+
+// Rastrigin is a sphere with a regular grid of local minima, one at each point of integer x. x starts at 2.5, on a ridge between them.
+// Solving it means finding the basin of the global minimum, so the threshold is the value of the nearest local minimum.
+func Rastrigin(dims int) Objective {
+	return Objective{
+		Name: "rastrigin",
+		Model: descend.ModelDef{
+			Params: vector(dims, 2.5),
+			Loss: func(s *op.Scope, params []tf.Output) tf.Output {
+				x := params[0]
+				waves := op.Mul(s, op.Const(s.SubScope("ten"), float32(10)), op.Cos(s, op.Mul(s, op.Const(s.SubScope("two_pi"), float32(2*math.Pi)), x)))
+				return op.Add(s, op.Const(s.SubScope("offset"), float32(10*dims)), sum(s, op.Sub(s, op.Square(s, x), waves)))
+			},
+		},
+		Threshold: 1,
+	}
+}
+
+// Ackley is nearly flat far from its minimum, with many shallow local minima, and a deep hole at x = 0. x starts at 2.5.
+func Ackley(dims int) Objective {
+	return Objective{
+		Name: "ackley",
+		Model: descend.ModelDef{
+			Params: vector(dims, 2.5),
+			Loss: func(s *op.Scope, params []tf.Output) tf.Output {
+				x := params[0]
+				// the small constant keeps the gradient of the square root finite at the minimum.
+				rms := op.Sqrt(s, op.Add(s, mean(s.SubScope("mean_square"), op.Square(s, x)), op.Const(s.SubScope("epsilon"), float32(1e-12))))
+				bowl := op.Mul(s, op.Const(s.SubScope("minus_twenty"), float32(-20)), op.Exp(s, op.Mul(s, op.Const(s.SubScope("minus_fifth"), float32(-0.2)), rms)))
+				waves := op.Exp(s, mean(s.SubScope("mean_cos"), op.Cos(s, op.Mul(s, op.Const(s.SubScope("two_pi"), float32(2*math.Pi)), x))))
+				return op.Add(s, op.Sub(s, bowl, waves), op.Const(s.SubScope("offset"), float32(20+math.E)))
+			},
+		},
+		Threshold: 0.1,
+	}
+}
+
+// Objectives returns the standard suite, each of dims dimensions.
+func Objectives(dims int) []Objective {
+	return []Objective{
+		Sphere(dims),
+		IllConditioned(dims, 1e4),
+		Rosenbrock(dims),
+		Rastrigin(dims),
+		Ackley(dims),
+	}
+}
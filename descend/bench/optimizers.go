@@ -0,0 +1,156 @@
+package bench
+
+import (
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// SeedSM steps a SeedSM by the best of numSeeds seeds each generation.
+func SeedSM(numSeeds int, stdev float32) Optimizer {
+	return Optimizer{
+		Name: "seed_sm",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeSM, newBestSeed, _, params := descend.NewSeedSM(s.SubScope("sm"), descend.MakeNoise(stdev), model.Params, numSeeds)
+			makeBestSeed := newBestSeed(model.Loss)
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeSM(sess)
+				if err != nil {
+					return
+				}
+				bestSeed, err := makeBestSeed(sess)
+				if err != nil {
+					return
+				}
+				opt = descend.NewSeedOptimizer(&sm, bestSeed)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// WeightedSeedSM steps a WeightedSeedSM by the centered ranks of numSeeds seeds, with Adam.
+func WeightedSeedSM(numSeeds int, stdev, learningRate float32) Optimizer {
+	return Optimizer{
+		Name: "weighted_seed_sm",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeSM, newSeedWeights, _, params := descend.NewWeightedSeedSM(s.SubScope("sm"), descend.MakeNoise(stdev), model.Params, numSeeds,
+				descend.WithUpdateRule(descend.Adam(learningRate, 0.9, 0.999, 1e-8)),
+			)
+			makeSeedWeights := newSeedWeights(model.Loss, op.Const(s.SubScope("seed_weight"), float32(1)), descend.Mirrored(), descend.WithFitnessShaping(descend.CenteredRanks))
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeSM(sess)
+				if err != nil {
+					return
+				}
+				seedWeights, err := makeSeedWeights(sess)
+				if err != nil {
+					return
+				}
+				opt = descend.NewWeightedSeedOptimizer(&sm, seedWeights)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// CMAES steps a separable CMA-ES with the default population size.
+func CMAES(sigma float32) Optimizer {
+	return Optimizer{
+		Name: "cmaes",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeCMAES, _, params := descend.NewCMAES(s.SubScope("cmaes"), model.Params, model.Loss, 0, sigma)
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeCMAES(sess)
+				if err != nil {
+					return
+				}
+				opt = descend.NewCMAESOptimizer(&sm)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// Gradient steps a GradientSM with Adam, for comparison with the black box optimizers.
+func Gradient(learningRate float32) Optimizer {
+	return Optimizer{
+		Name: "gradient",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeGradientSM, _, params := descend.NewGradientSM(s.SubScope("gradient_sm"), model.Params, model.Loss, descend.Adam(learningRate, 0.9, 0.999, 1e-8))
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeGradientSM(sess)
+				if err != nil {
+					return
+				}
+				opt = descend.NewGradientOptimizer(&sm)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// GA steps a Deep-GA with a population of popSize, whose mutations are drawn from numSeeds seeds.
+func GA(popSize, numSeeds int, stdev float32) Optimizer {
+	return Optimizer{
+		Name: "ga",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeSM, newBestSeed, _, params := descend.NewSeedSM(s.SubScope("sm"), descend.MakeNoise(stdev), model.Params, numSeeds, descend.ChunkedEval(16))
+			graph := descend.FitnessGraph{}
+			newBestSeed(model.Loss, descend.ExportFitnessGraph(&graph))
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeSM(sess)
+				if err != nil {
+					return
+				}
+				ga, err := descend.NewGA(&sm, graph, popSize)
+				if err != nil {
+					return
+				}
+				opt = descend.NewGAOptimizer(&ga)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// HillClimbing steps a SeedSM by random seeds, and rewinds the steps which make the loss worse.
+func HillClimbing(stdev float32) Optimizer {
+	return Optimizer{
+		Name: "hill_climbing",
+		Make: func(s *op.Scope, model descend.ModelDef) (makeOptimizer func(*tf.Session) (descend.Optimizer, error), params []tf.Output) {
+			makeSM, _, _, params := descend.NewSeedSM(s.SubScope("sm"), descend.MakeNoise(stdev), model.Params, 1)
+			loss := model.Loss(s.SubScope("loss"), params)
+			makeOptimizer = func(sess *tf.Session) (opt descend.Optimizer, err error) {
+				sm, err := makeSM(sess)
+				if err != nil {
+					return
+				}
+				ls, err := descend.NewHillClimbing(&sm, loss, nil)
+				if err != nil {
+					return
+				}
+				opt = descend.NewLocalSearchOptimizer(&ls)
+				return
+			}
+			return makeOptimizer, params
+		},
+	}
+}
+
+// Optimizers returns each of the optimizers of descend, with settings which suit the objectives of this package.
+func Optimizers() []Optimizer {
+	return []Optimizer{
+		SeedSM(20, 0.05),
+		WeightedSeedSM(20, 0.05, 0.05),
+		CMAES(0.5),
+		Gradient(0.05),
+		GA(30, 10000, 0.05),
+		HillClimbing(0.05),
+	}
+}
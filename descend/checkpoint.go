@@ -0,0 +1,310 @@
+package descend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// ErrCheckpointMismatch is returned by Load when replaying the lineage of a checkpoint does not reproduce the params which were saved.
+// This usually means that the param defs differ from those of the run which saved it.
+var ErrCheckpointMismatch = errors.New("descend: replayed params do not match checkpoint")
+
+// ErrNoiseMismatch is returned by Load when the state machine makes different noise to the one which saved the checkpoint,
+// because its noise func, the stdev given to it, or the NoiseScale of a param differ.
+var ErrNoiseMismatch = errors.New("descend: checkpoint was saved with different noise, check the noise func, its stdev, and the NoiseScale of each param")
+
+// checkpoint is what gets written to disk.
+// The params are not stored, only the lineage needed to replay them, and a digest to check that the replay was exact.
+type checkpoint struct {
+	Generation  int64
+	Seeds       []int64     // for SeedSM
+	SeedWeights [][]float32 // for WeightedSeedSM
+	NumSeeds    int         // for WeightedSeedSM
+	Sigmas      []float32   // the sigma used by each step
+	Sigma       float32     // the sigma for the next step
+	Digest      []byte      // sha256 of the params at save time
+	SeedScheme  SeedScheme  // checkpoints saved before there were schemes decode as LegacySeeds
+	HasSigmas   bool        // false for checkpoints saved before sigma could change. gob drops empty slices, so Sigmas can not tell.
+	NoiseDigest []byte      // sha256 of the noise of each param for a fixed seed and generation. Empty in checkpoints saved before it was recorded.
+}
+
+// checkScheme errors if the checkpoint was saved with a different seed scheme to that of the state machine.
+func (c checkpoint) checkScheme(scheme SeedScheme) error {
+	if c.SeedScheme != scheme {
+		return fmt.Errorf("descend: checkpoint uses seed scheme %d but state machine uses %d, make it with WithSeedScheme(%d)", c.SeedScheme, scheme, c.SeedScheme)
+	}
+	return nil
+}
+
+// sigmas returns the sigmas of the checkpoint.
+// Checkpoints saved before sigma could change have none, and used a sigma of 1 throughout.
+func (c checkpoint) sigmas() (sigmas []float32, sigma float32, err error) {
+	if !c.HasSigmas {
+		sigmas = make([]float32, c.Generation)
+		for i := range sigmas {
+			sigmas[i] = 1
+		}
+		return sigmas, 1, nil
+	}
+	if int64(len(c.Sigmas)) != c.Generation {
+		err = fmt.Errorf("descend: checkpoint has %d sigmas but is at generation %d", len(c.Sigmas), c.Generation)
+		return
+	}
+	return c.Sigmas, c.Sigma, nil
+}
+
+// Noise probes use this seed and generation, which no step uses, as generations start at 1.
+const (
+	noiseProbeSeed int64 = 0
+	noiseProbeGen  int64 = 0
+)
+
+// makeNoiseProbe makes the noise of each param which is not frozen for a fixed seed and generation, so that checkpoints can record a digest of the noise config.
+// inits are the initial values of the params, from which the shapes are taken.
+func makeNoiseProbe(s *op.Scope, noise NoiseFunc, scheme SeedScheme, paramDefs []ParamDef, inits []tf.Output) (probe []tf.Output) {
+	seed := op.Const(s.SubScope("seed"), noiseProbeSeed)
+	gen := op.Const(s.SubScope("gen"), noiseProbeGen)
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			continue
+		}
+		paramScope := s.SubScope(pd.Name)
+		shape := op.Shape(paramScope, inits[i], op.ShapeOutType(tf.Int32))
+		probe = append(probe, pd.paramNoise(noise)(paramScope.SubScope("noise"), shape, paramSeed(paramScope, scheme, seed, i, pd.Name), gen))
+	}
+	return
+}
+
+// noiseDigest hashes the noise made by probe.
+func noiseDigest(sess *tf.Session, probe []tf.Output) (digest []byte, err error) {
+	if len(probe) == 0 {
+		return
+	}
+	return paramsDigest(sess, probe)
+}
+
+// checkNoise errors if the noise made by probe does not match that of the checkpoint.
+func (c checkpoint) checkNoise(sess *tf.Session, probe []tf.Output) (err error) {
+	if len(c.NoiseDigest) == 0 {
+		return
+	}
+	digest, err := noiseDigest(sess, probe)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(digest, c.NoiseDigest) {
+		return ErrNoiseMismatch
+	}
+	return
+}
+
+// paramsDigest reads the params and hashes their contents.
+func paramsDigest(sess *tf.Session, params []tf.Output) (digest []byte, err error) {
+	tensors, err := sess.Run(nil, params, nil)
+	if err != nil {
+		return
+	}
+	h := sha256.New()
+	for _, tensor := range tensors {
+		_, err = tensor.WriteContentsTo(h)
+		if err != nil {
+			return
+		}
+	}
+	digest = h.Sum(nil)
+	return
+}
+
+// checkDigest errors if the params no longer match the digest.
+func checkDigest(sess *tf.Session, params []tf.Output, digest []byte) (err error) {
+	actual, err := paramsDigest(sess, params)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(actual, digest) {
+		return ErrCheckpointMismatch
+	}
+	return
+}
+
+// saveFile writes to a temp file and then renames it, so that a crash while saving does not destroy the previous checkpoint.
+func saveFile(path string, save func(io.Writer) error) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(file.Name()) // does nothing once it has been renamed.
+	err = save(file)
+	if err != nil {
+		file.Close()
+		return
+	}
+	err = file.Close()
+	if err != nil {
+		return
+	}
+	err = os.Rename(file.Name(), path)
+	return
+}
+
+// loadFile opens path and passes it to load.
+func loadFile(path string, load func(io.Reader) error) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	err = load(file)
+	return
+}
+
+// Save writes the generation, seeds and sigmas of the state machine to w, with a digest of its noise, so that Load can tell if the noise config has changed.
+// If the state machine has been rewound since its params were last replayed, it first replays them, so that they match those which Load rebuilds.
+func (sm *SeedSM) Save(w io.Writer) (err error) {
+	err = sm.resync()
+	if err != nil {
+		return
+	}
+	digest, err := paramsDigest(sm.sess, sm.params)
+	if err != nil {
+		return
+	}
+	noise, err := noiseDigest(sm.sess, sm.noiseProbe)
+	if err != nil {
+		return
+	}
+	err = gob.NewEncoder(w).Encode(checkpoint{
+		Generation:  sm.Generation,
+		Seeds:       sm.Seeds,
+		Sigmas:      sm.Sigmas,
+		Sigma:       sm.Sigma,
+		HasSigmas:   true,
+		NoiseDigest: noise,
+		Digest:      digest,
+		SeedScheme:  sm.seedScheme,
+	})
+	return
+}
+
+// Load reads a checkpoint written by Save, and replays its seeds to rebuild the params.
+// The state machine must have been made from the same noise func, param defs and seed scheme as the one which was saved.
+func (sm *SeedSM) Load(r io.Reader) (err error) {
+	c := checkpoint{}
+	err = gob.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return
+	}
+	err = c.checkScheme(sm.seedScheme)
+	if err != nil {
+		return
+	}
+	err = c.checkNoise(sm.sess, sm.noiseProbe)
+	if err != nil {
+		return
+	}
+	if int64(len(c.Seeds)) != c.Generation {
+		return fmt.Errorf("descend: checkpoint has %d seeds but is at generation %d", len(c.Seeds), c.Generation)
+	}
+	sigmas, sigma, err := c.sigmas()
+	if err != nil {
+		return
+	}
+	err = sm.replay(c.Seeds, sigmas, sigma)
+	if err != nil {
+		return
+	}
+	err = checkDigest(sm.sess, sm.params, c.Digest)
+	return
+}
+
+// SaveFile saves the state machine to the file at path.
+func (sm *SeedSM) SaveFile(path string) error {
+	return saveFile(path, sm.Save)
+}
+
+// LoadFile loads the state machine from the file at path.
+func (sm *SeedSM) LoadFile(path string) error {
+	return loadFile(path, sm.Load)
+}
+
+// Save writes the generation, seed weights and sigmas of the state machine to w, with a digest of its noise, so that Load can tell if the noise config has changed.
+// If the state machine has been rewound since its params were last replayed, it first replays them, so that they match those which Load rebuilds.
+func (sm *WeightedSeedSM) Save(w io.Writer) (err error) {
+	err = sm.resync()
+	if err != nil {
+		return
+	}
+	digest, err := paramsDigest(sm.sess, sm.params)
+	if err != nil {
+		return
+	}
+	noise, err := noiseDigest(sm.sess, sm.noiseProbe)
+	if err != nil {
+		return
+	}
+	err = gob.NewEncoder(w).Encode(checkpoint{
+		Generation:  sm.Generation,
+		SeedWeights: sm.SeedWeights,
+		NumSeeds:    sm.numSeeds,
+		Sigmas:      sm.Sigmas,
+		Sigma:       sm.Sigma,
+		HasSigmas:   true,
+		NoiseDigest: noise,
+		Digest:      digest,
+		SeedScheme:  sm.seedScheme,
+	})
+	return
+}
+
+// Load reads a checkpoint written by Save, and replays its seed weights to rebuild the params.
+// The state machine must have been made from the same noise func, param defs, number of seeds and seed scheme as the one which was saved.
+func (sm *WeightedSeedSM) Load(r io.Reader) (err error) {
+	c := checkpoint{}
+	err = gob.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return
+	}
+	err = c.checkScheme(sm.seedScheme)
+	if err != nil {
+		return
+	}
+	err = c.checkNoise(sm.sess, sm.noiseProbe)
+	if err != nil {
+		return
+	}
+	if c.NumSeeds != sm.numSeeds {
+		return fmt.Errorf("descend: checkpoint has %d seeds but state machine has %d", c.NumSeeds, sm.numSeeds)
+	}
+	if int64(len(c.SeedWeights)) != c.Generation {
+		return fmt.Errorf("descend: checkpoint has %d seed weights but is at generation %d", len(c.SeedWeights), c.Generation)
+	}
+	sigmas, sigma, err := c.sigmas()
+	if err != nil {
+		return
+	}
+	err = sm.replay(c.SeedWeights, sigmas, sigma)
+	if err != nil {
+		return
+	}
+	err = checkDigest(sm.sess, sm.params, c.Digest)
+	return
+}
+
+// SaveFile saves the state machine to the file at path.
+func (sm *WeightedSeedSM) SaveFile(path string) error {
+	return saveFile(path, sm.Save)
+}
+
+// LoadFile loads the state machine from the file at path.
+func (sm *WeightedSeedSM) LoadFile(path string) error {
+	return loadFile(path, sm.Load)
+}
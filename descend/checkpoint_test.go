@@ -0,0 +1,203 @@
+package descend
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/is8ac/tfutils"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+var checkpointParamDefs = []ParamDef{
+	ParamDef{Name: "foo", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+	ParamDef{Name: "bar", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+}
+
+func TestSeedSMCheckpoint(t *testing.T) {
+	noise := MakeNoise(0.003)
+	sm1, ts1 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+	sm2, ts2 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+	for _, seed := range []int64{3, 1, 4, 1, 5} {
+		err := sm1.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "seed_sm.ckpt")
+	err := sm1.SaveFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.Generation != sm1.Generation || !reflect.DeepEqual(sm2.Seeds, sm1.Seeds) {
+		t.Fatal("lineage was not restored", sm1.Seeds, sm2.Seeds)
+	}
+	// the resumed run must continue exactly as the uninterrupted one.
+	for _, seed := range []int64{9, 2, 6} {
+		err = sm1.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm2.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("params are different")
+	}
+}
+
+func TestWeightedSeedSMCheckpoint(t *testing.T) {
+	noise := MakeNoise(0.003)
+	sm1, ts1 := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withNumSeeds(3))
+	sm2, ts2 := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withNumSeeds(3))
+	err := sm1.Step([]float32{0.2, 0.8, -0.3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Step([]float32{0.6, -0.4, 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = sm1.Save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Step([]float32{0.1, 0.1, 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Step([]float32{0.1, 0.1, 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.Generation != sm1.Generation {
+		t.Fatal("generations are different", sm1.Generation, sm2.Generation)
+	}
+	if !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("params are different")
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	sm1, _ := newTestSeedSM(t, withParamDefs(checkpointParamDefs))
+	sm2, _ := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(MakeNoise(0.1)))
+	err := sm1.Step(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = sm1.Save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Load(buf)
+	if err != ErrNoiseMismatch {
+		t.Fatal("expected ErrNoiseMismatch, got", err)
+	}
+}
+
+// saveAndLoad saves a SeedSM made from paramDefs, and loads it into one made from otherParamDefs.
+func saveAndLoad(t *testing.T, paramDefs, otherParamDefs []ParamDef) error {
+	sm1, _ := newTestSeedSM(t, withParamDefs(paramDefs))
+	sm2, _ := newTestSeedSM(t, withParamDefs(otherParamDefs))
+	err := sm1.Step(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = sm1.Save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm2.Load(buf)
+}
+
+func TestCheckpointParamDefsMismatch(t *testing.T) {
+	scaled := []ParamDef{checkpointParamDefs[0], checkpointParamDefs[1]}
+	scaled[1].NoiseScale = 2
+	err := saveAndLoad(t, checkpointParamDefs, scaled)
+	if err != ErrNoiseMismatch {
+		t.Fatal("expected ErrNoiseMismatch for a different NoiseScale, got", err)
+	}
+	ones := []ParamDef{checkpointParamDefs[0], ParamDef{Name: "bar", Init: func(s *op.Scope) tf.Output {
+		return op.Const(s, float32(1))
+	}}}
+	err = saveAndLoad(t, checkpointParamDefs, ones)
+	if err != ErrCheckpointMismatch {
+		t.Fatal("expected ErrCheckpointMismatch for a different init, got", err)
+	}
+}
+
+// Rewinding may not give back exactly the params of the lineage, so a checkpoint saved after a rewind must still load.
+func TestCheckpointAfterRewind(t *testing.T) {
+	noise := MakeNoise(1)
+	sm1, ts1 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+	sm2, ts2 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+	for _, seed := range []int64{3, 1, 4, 1, 5} {
+		err := sm1.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm1.Step(seed + 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm1.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.Buffer{}
+	err := sm1.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("params are different")
+	}
+
+	weightedSM1, weightedTS1 := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withNumSeeds(3))
+	weightedSM2, weightedTS2 := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withNumSeeds(3))
+	for _, weights := range [][]float32{{0.3, -1, 2}, {1.7, 0.1, -0.6}, {-2, 0.9, 0.4}} {
+		err = weightedSM1.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = weightedSM1.Step([]float32{weights[2], weights[0], weights[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = weightedSM1.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = weightedSM1.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = weightedSM2.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readParams(t, weightedTS1.sess, weightedTS1.params), readParams(t, weightedTS2.sess, weightedTS2.params)) {
+		t.Fatal("weighted params are different")
+	}
+}
@@ -0,0 +1,159 @@
+package descend
+
+import (
+	"strconv"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// ChunkedEval makes newBestSeed and newSeedWeights build the loss subgraph for only chunkSize seeds, and evaluate the seeds chunkSize at a time by feeding in their indices.
+// The graph then stays the same size however many seeds there are, at the cost of one session run per chunk.
+// If the loss reads from a queue, each chunk will see a different batch.
+// WeightedSeedSM also takes each step a chunk of seeds at a time, summing their weighted noise into one extra variable per param, so that neither the graph nor the memory of a step grows with the number of seeds.
+func ChunkedEval(chunkSize int) SMOption {
+	return func(c *smConfig) {
+		c.chunkSize = chunkSize
+	}
+}
+
+// makeSeedIndices makes a placeholder for the indices of a chunk of seeds, and unpacks it into one seed per copy of the model.
+func makeSeedIndices(s *op.Scope, chunkSize int) (indices tf.Output, seeds []tf.Output) {
+	indices = op.Placeholder(s.SubScope("seed_indices"), tf.Int64, op.PlaceholderShape(tf.MakeShape(int64(chunkSize))))
+	seeds = op.Unpack(s.SubScope("unpack"), indices, int64(chunkSize))
+	return
+}
+
+// noiseChunks holds the ops with which a WeightedSeedSM made with ChunkedEval sums the weighted noise of its seeds, a chunk at a time.
+type noiseChunks struct {
+	size      int
+	seedsPH   tf.Output // the indices of a chunk of seeds.
+	weightsPH tf.Output // the weights of the chunk of seeds.
+	genPH     tf.Output
+	seeds     []tf.Output
+	weights   []tf.Output
+	reset     []*tf.Operation // zero the sums.
+	add       []*tf.Operation // add the weighted noise of a chunk to the sums.
+}
+
+// makeNoiseChunks makes placeholders for a chunk of seeds and their weights, and unpacks them.
+func makeNoiseChunks(s *op.Scope, genPH tf.Output, chunkSize int) (chunks noiseChunks) {
+	chunks = noiseChunks{size: chunkSize, genPH: genPH}
+	chunks.seedsPH, chunks.seeds = makeSeedIndices(s, chunkSize)
+	chunks.weightsPH = op.Placeholder(s.SubScope("weights"), tf.Float, op.PlaceholderShape(tf.MakeShape(int64(chunkSize))))
+	chunks.weights = op.Unpack(s.SubScope("unpack_weights"), chunks.weightsPH, int64(chunkSize))
+	return
+}
+
+// addParam makes a variable to hold the sum of the weighted noise of a param, and the ops to zero it and to add the noise of a chunk to it.
+// seedNoise makes the noise of the param for one seed.
+func (c *noiseChunks) addParam(s *op.Scope, name string, zeroParam tf.Output, seedNoise func(*op.Scope, tf.Output) tf.Output) (sum tf.Output) {
+	sumVar := op.VarHandleOp(s, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(name))
+	c.reset = append(c.reset, op.AssignVariableOp(s.SubScope("reset"), sumVar, op.ZerosLike(s, zeroParam)))
+	noises := make([]tf.Output, c.size)
+	for i, seed := range c.seeds {
+		seedScope := s.SubScope("seed_" + strconv.Itoa(i))
+		noises[i] = op.Mul(seedScope, seedNoise(seedScope, seed), c.weights[i])
+	}
+	c.add = append(c.add, op.AssignAddVariableOp(s.SubScope("add"), sumVar, op.AddN(s, noises)))
+	return op.ReadVariableOp(s, sumVar, zeroParam.DataType())
+}
+
+// sum zeroes the sums, and adds to them the noise of every seed at generation gen, scaled by its weight.
+func (c noiseChunks) sum(sess *tf.Session, gen *tf.Tensor, weights []float32) (err error) {
+	_, err = sess.Run(nil, nil, c.reset)
+	if err != nil {
+		return
+	}
+	seeds := make([]int64, c.size)
+	chunkWeights := make([]float32, c.size)
+	for start := 0; start < len(weights); start += c.size {
+		for i := range seeds {
+			seeds[i], chunkWeights[i] = 0, 0 // pad the last chunk with seeds of no weight.
+			if start+i < len(weights) {
+				seeds[i], chunkWeights[i] = int64(start+i), weights[start+i]
+			}
+		}
+		var seedsTensor, weightsTensor *tf.Tensor
+		seedsTensor, err = tf.NewTensor(seeds)
+		if err != nil {
+			panic(err)
+		}
+		weightsTensor, err = tf.NewTensor(chunkWeights)
+		if err != nil {
+			panic(err)
+		}
+		_, err = sess.Run(map[tf.Output]*tf.Tensor{c.seedsPH: seedsTensor, c.weightsPH: weightsTensor, c.genPH: gen}, nil, c.add)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// seedRange returns the indices of the first n seeds.
+func seedRange(n int) (seeds []int) {
+	seeds = make([]int, n)
+	for i := range seeds {
+		seeds[i] = i
+	}
+	return
+}
+
+// evalChunks feeds the seeds to indices chunkSize at a time, along with feeds, and returns the value of output for each of them.
+func evalChunks(sess *tf.Session, feeds map[tf.Output]*tf.Tensor, indices, output tf.Output, chunkSize int, seeds []int) (values []float32, err error) {
+	values = make([]float32, 0, len(seeds)+chunkSize)
+	err = runChunks(sess, feeds, indices, []tf.Output{output}, chunkSize, seeds, func(_ map[tf.Output]*tf.Tensor, results []*tf.Tensor) error {
+		values = append(values, results[0].Value().([]float32)...)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	values = values[:len(seeds)]
+	return
+}
+
+// runChunks feeds the seeds to indices chunkSize at a time, along with feeds, and passes the feeds and the values of outputs for each chunk to use.
+// The last chunk is padded, so use gets chunkSize values each time, of which the caller should keep only as many as there are seeds.
+func runChunks(sess *tf.Session, feeds map[tf.Output]*tf.Tensor, indices tf.Output, outputs []tf.Output, chunkSize int, seeds []int, use func(map[tf.Output]*tf.Tensor, []*tf.Tensor) error) (err error) {
+	chunk := make([]int64, chunkSize)
+	for start := 0; start < len(seeds); start += chunkSize {
+		for i := range chunk {
+			if start+i < len(seeds) {
+				chunk[i] = int64(seeds[start+i])
+			} else {
+				chunk[i] = int64(seeds[len(seeds)-1]) // pad the last chunk by evaluating the last seed again.
+			}
+		}
+		var indicesTensor *tf.Tensor
+		indicesTensor, err = tf.NewTensor(chunk)
+		if err != nil {
+			return
+		}
+		chunkFeeds := map[tf.Output]*tf.Tensor{indices: indicesTensor}
+		for fed, tensor := range feeds {
+			chunkFeeds[fed] = tensor
+		}
+		var results []*tf.Tensor
+		results, err = sess.Run(chunkFeeds, outputs, nil)
+		if err != nil {
+			return
+		}
+		err = use(chunkFeeds, results)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// fittestSeed returns the index of the first of the fittest seeds.
+func fittestSeed(fitness []float32) (seed int64) {
+	for i, f := range fitness {
+		if f > fitness[seed] {
+			seed = int64(i)
+		}
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package descend
+
+import (
+	"testing"
+)
+
+// makeChunkedEval makes the funcs to get the best seed, and the seed weights, of numSeeds seeds.
+// numOps is the number of ops in the graphs of both.
+func makeChunkedEval(t *testing.T, numSeeds int, options ...SMOption) (bestSeed func() (int64, error), seedWeights func() ([]float32, error), numOps int) {
+	_, seedTS := newTestSeedSM(t, withNumSeeds(numSeeds), withSMOptions(options...))
+	_, weightedTS := newTestWeightedSeedSM(t, withNumSeeds(numSeeds), withSMOptions(options...))
+	numOps = len(seedTS.graph.Operations()) + len(weightedTS.graph.Operations())
+	return seedTS.bestSeed, weightedTS.seedWeights, numOps
+}
+
+func TestChunkedEval(t *testing.T) {
+	bestSeed, seedWeights, _ := makeChunkedEval(t, 5)
+	chunkedBestSeed, chunkedSeedWeights, _ := makeChunkedEval(t, 5, ChunkedEval(2)) // the last chunk is only half full.
+	seed, err := bestSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkedSeed, err := chunkedBestSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed != chunkedSeed {
+		t.Fatal("best seeds are different", seed, chunkedSeed)
+	}
+	weights, err := seedWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkedWeights, err := chunkedSeedWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !paramsClose(weights, chunkedWeights) {
+		t.Fatal("weights are different", weights, chunkedWeights)
+	}
+}
+
+func TestChunkedEvalGraphSize(t *testing.T) {
+	_, _, fewOps := makeChunkedEval(t, 5, ChunkedEval(2))
+	_, _, manyOps := makeChunkedEval(t, 50, ChunkedEval(2))
+	if fewOps != manyOps {
+		t.Fatal("graph grew with the number of seeds", fewOps, manyOps)
+	}
+}
+
+// A chunked step must move the params as an unchunked one does, and rewind them the same way.
+func TestChunkedStep(t *testing.T) {
+	sm, ts := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs))
+	chunkedSM, chunkedTS := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withSMOptions(ChunkedEval(2))) // the last chunk is only half full.
+	for _, weights := range [][]float32{{0.2, 0.8, -0.3, 1, 0}, {0.6, -0.4, 1.5, 0, 2}} {
+		for _, weightedSM := range []*WeightedSeedSM{&sm, &chunkedSM} {
+			err := weightedSM.Step(weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !paramsClose(readParams(t, ts.sess, ts.params), readParams(t, chunkedTS.sess, chunkedTS.params)) {
+			t.Fatal("chunked step moved the params differently")
+		}
+	}
+	for _, weightedSM := range []*WeightedSeedSM{&sm, &chunkedSM} {
+		err := weightedSM.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !paramsClose(readParams(t, ts.sess, ts.params), readParams(t, chunkedTS.sess, chunkedTS.params)) {
+		t.Fatal("chunked rewind moved the params differently")
+	}
+	err := chunkedSM.Step([]float32{1, 2})
+	if err == nil || chunkedSM.Generation != 1 {
+		t.Fatal("expected an error for the wrong number of weights, and no step")
+	}
+}
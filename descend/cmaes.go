@@ -0,0 +1,307 @@
+package descend
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// CMAES is a state machine for the separable (diagonal) CMA-ES.
+// It adapts one variance per param, rather than a full covariance matrix, so it can be used on models with many params.
+// The mean is kept in the param variables, and the covariance, evolution paths and step size are kept in variables next to them.
+type CMAES struct {
+	Generation int64
+	Loss       float32 // the lowest loss of the population of the last step.
+	sess       *tf.Session
+	step       []*tf.Operation
+	bestLoss   tf.Output
+	sigma      tf.Output
+	params     []tf.Output
+}
+
+// Step samples a population around the mean, evaluates it, and moves the mean, covariance and step size according to the best of them.
+func (sm *CMAES) Step() (err error) {
+	results, err := sm.sess.Run(nil, []tf.Output{sm.bestLoss}, sm.step)
+	if err != nil {
+		return
+	}
+	sm.Generation++
+	sm.Loss = results[0].Value().(float32)
+	return
+}
+
+// Sigma returns the current step size.
+func (sm *CMAES) Sigma() (sigma float32, err error) {
+	results, err := sm.sess.Run(nil, []tf.Output{sm.sigma}, nil)
+	if err != nil {
+		return
+	}
+	sigma = results[0].Value().(float32)
+	return
+}
+
+// cmaesConsts are the strategy parameters of sep-CMA-ES, as given by Ros and Hansen.
+type cmaesConsts struct {
+	weights []float32 // the recombination weights of the mu best.
+	muEff   float64
+	cSigma  float64
+	dSigma  float64
+	cC      float64
+	c1      float64
+	cMu     float64
+	chiN    float64 // the expected length of a n dimensional standard normal vector.
+}
+
+func makeCMAESConsts(n, lambda int) (c cmaesConsts) {
+	mu := lambda / 2
+	nf := float64(n)
+	raw := make([]float64, mu)
+	var sum, sumSqr float64
+	for i := range raw {
+		raw[i] = math.Log(float64(mu)+0.5) - math.Log(float64(i+1))
+		sum += raw[i]
+	}
+	c.weights = make([]float32, mu)
+	for i := range raw {
+		w := raw[i] / sum
+		c.weights[i] = float32(w)
+		sumSqr += w * w
+	}
+	c.muEff = 1 / sumSqr
+	c.cSigma = (c.muEff + 2) / (nf + c.muEff + 5)
+	c.dSigma = 1 + 2*math.Max(0, math.Sqrt((c.muEff-1)/(nf+1))-1) + c.cSigma
+	c.cC = (4 + c.muEff/nf) / (nf + 4 + 2*c.muEff/nf)
+	c1 := 2 / ((nf+1.3)*(nf+1.3) + c.muEff)
+	cMu := math.Min(1-c1, 2*(c.muEff-2+1/c.muEff)/((nf+2)*(nf+2)+c.muEff))
+	// the diagonal only model can learn faster.
+	c.c1 = c1 * (nf + 2) / 3
+	c.cMu = math.Min(1-c.c1, cMu*(nf+2)/3)
+	c.chiN = math.Sqrt(nf) * (1 - 1/(4*nf) + 1/(21*nf*nf))
+	return
+}
+
+// NewCMAES creates TF OPs for a separable CMA-ES state machine which minimizes the loss of the params.
+// popSize is the number of samples evaluated each step. If it is less than 2, the usual default of 4+3ln(n) is used.
+// sigma is the initial step size. All the params must be floats of fully known shape.
+func NewCMAES(s *op.Scope,
+	paramDefs []ParamDef,
+	lossFunc LossFunc,
+	popSize int,
+	sigma float32,
+) (
+	makeCMAES func(*tf.Session) (CMAES, error),
+	generation tf.Output,
+	params []tf.Output,
+) {
+	paramCount := len(paramDefs)
+	ns := namespace(s, "NewCMAES", paramDefs)
+	// we start by making the variables.
+	generationScope := s.SubScope("generation")
+	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "generation")))
+	initGeneration := op.AssignVariableOp(generationScope.SubScope("init"), generationVar, op.Const(generationScope.SubScope("zero"), int64(0)))
+	generation = op.ReadVariableOp(generationScope, generationVar, tf.Int64)
+	sigmaScope := s.SubScope("sigma")
+	sigmaVar := op.VarHandleOp(sigmaScope, tf.Float, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "sigma")))
+	initSigma := op.AssignVariableOp(sigmaScope.SubScope("init"), sigmaVar, op.Const(sigmaScope.SubScope("initial"), sigma))
+	sigmaOutput := op.ReadVariableOp(sigmaScope, sigmaVar, tf.Float)
+
+	initOps := []*tf.Operation{initGeneration, initSigma}
+	params = make([]tf.Output, paramCount)
+	means := make([]tf.Output, paramCount)       // the handles of the param variables, which hold the mean
+	flatMeans := make([]tf.Output, paramCount)   // the params, flattened to vectors
+	paramShapes := make([]tf.Output, paramCount) // so that we can unflatten them
+	sizes := make([]int64, paramCount)           // the number of elements in each param
+	covs := make([]tf.Output, paramCount)        // the diagonal of the covariance matrix
+	sigmaPaths := make([]tf.Output, paramCount)
+	covPaths := make([]tf.Output, paramCount)
+	n := 0 // the total number of params
+	for i, pd := range paramDefs {
+		paramScope := s.SubScope(pd.Name)
+		zeroParam := pd.Init(paramScope.SubScope("init_val"))
+		means[i] = op.VarHandleOp(paramScope, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name)))
+		initOps = append(initOps, op.AssignVariableOp(paramScope, means[i], zeroParam))
+		params[i] = op.ReadVariableOp(paramScope, means[i], zeroParam.DataType())
+		if pd.Frozen { // frozen params are not sampled, and have no state.
+			continue
+		}
+		dims, err := zeroParam.Shape().ToSlice()
+		if err != nil {
+			s.UpdateErr("NewCMAES", err)
+			return
+		}
+		sizes[i] = 1
+		for _, dim := range dims {
+			if dim < 0 {
+				s.UpdateErr("NewCMAES", errors.New("shape of param "+pd.Name+" is not fully known"))
+				return
+			}
+			sizes[i] *= dim
+		}
+		n += int(sizes[i])
+		flatMeans[i] = op.Reshape(paramScope.SubScope("flat"), params[i], op.Const(paramScope.SubScope("flat_shape"), []int64{-1}))
+		paramShapes[i] = op.Shape(paramScope, zeroParam)
+		flatShape := op.Const(paramScope.SubScope("size"), []int64{sizes[i]})
+		newStateVar := func(name string, value float32) tf.Output {
+			varScope := paramScope.SubScope(name)
+			handle := op.VarHandleOp(varScope, tf.Float, tf.MakeShape(sizes[i]), op.VarHandleOpSharedName(sharedName(ns, pd.Name+"/cmaes_"+name)))
+			initOps = append(initOps, op.AssignVariableOp(varScope.SubScope("init"), handle, op.Fill(varScope, flatShape, op.Const(varScope.SubScope("value"), value))))
+			return handle
+		}
+		// the NoiseScale of the param scales its initial standard deviation.
+		noiseScale := pd.NoiseScale
+		if noiseScale == 0 {
+			noiseScale = 1
+		}
+		covs[i] = newStateVar("cov", noiseScale*noiseScale)
+		sigmaPaths[i] = newStateVar("sigma_path", 0)
+		covPaths[i] = newStateVar("cov_path", 0)
+	}
+	if n == 0 {
+		s.UpdateErr("NewCMAES", errors.New("all the params are frozen"))
+		return
+	}
+	if popSize < 2 {
+		popSize = 4 + int(3*math.Log(float64(n)))
+	}
+	consts := makeCMAESConsts(n, popSize)
+	mu := len(consts.weights)
+	c := func(name string, value float64) tf.Output {
+		return op.Const(s.SubScope(name), float32(value))
+	}
+
+	// now we sample the population.
+	stepScope := s.SubScope("step")
+	nextGen := op.Add(stepScope, generation, op.Const(stepScope.SubScope("one"), int64(1)))
+	oldCovs := make([]tf.Output, paramCount)
+	stdevs := make([]tf.Output, paramCount)
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			continue
+		}
+		oldCovs[i] = op.ReadVariableOp(stepScope.SubScope("cov"), covs[i], tf.Float)
+		stdevs[i] = op.Sqrt(stepScope.SubScope("stdev"), oldCovs[i])
+	}
+	zs := make([][]tf.Output, paramCount) // the standard normal samples of each param, for each child
+	ys := make([][]tf.Output, paramCount) // the same, scaled by the covariance
+	for i := range paramDefs {
+		zs[i] = make([]tf.Output, popSize)
+		ys[i] = make([]tf.Output, popSize)
+	}
+	losses := make([]tf.Output, popSize)
+	for k := 0; k < popSize; k++ {
+		childScope := stepScope.SubScope("child" + strconv.Itoa(k))
+		childParams := make([]tf.Output, paramCount)
+		for i, pd := range paramDefs {
+			if pd.Frozen {
+				childParams[i] = params[i]
+				continue
+			}
+			paramScope := childScope.SubScope("param_" + strconv.Itoa(i))
+			seed := op.Pack(paramScope, []tf.Output{nextGen, op.Const(paramScope.SubScope("seed"), int64(k*paramCount+i))})
+			zs[i][k] = op.StatelessRandomNormal(paramScope, op.Const(paramScope.SubScope("shape"), []int64{sizes[i]}), seed, op.StatelessRandomNormalDtype(tf.Float))
+			ys[i][k] = op.Mul(paramScope.SubScope("y"), zs[i][k], stdevs[i])
+			flatChild := op.Add(paramScope, flatMeans[i], op.Mul(paramScope.SubScope("sigma"), ys[i][k], sigmaOutput))
+			childParams[i] = op.Reshape(paramScope, flatChild, paramShapes[i])
+		}
+		losses[k] = lossFunc(childScope.SubScope("model"), childParams)
+	}
+	// select the mu best.
+	packedLosses := op.Pack(stepScope.SubScope("losses"), losses)
+	bestLoss := op.Min(stepScope.SubScope("best_loss"), packedLosses, op.Const(stepScope.SubScope("best_loss_dims"), int32(0)))
+	_, best := op.TopKV2(stepScope.SubScope("best"), op.Neg(stepScope, packedLosses), op.Const(stepScope.SubScope("mu"), int32(mu)))
+	weights := op.Const(stepScope.SubScope("weights"), [][]float32{consts.weights}) // [1, mu], so that we can MatMul it
+	weightedSum := func(s *op.Scope, samples []tf.Output) tf.Output {
+		selected := op.Gather(s, op.Pack(s, samples), best)
+		return op.Reshape(s, op.MatMul(s, weights, selected), op.Const(s.SubScope("shape"), []int64{-1}))
+	}
+	yWs := make([]tf.Output, paramCount)
+	zWs := make([]tf.Output, paramCount)
+	yWSqrs := make([]tf.Output, paramCount) // the weighted sum of the squares of the ys
+	newSigmaPaths := make([]tf.Output, paramCount)
+	sigmaPathSqrs := []tf.Output{}
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			continue
+		}
+		paramScope := stepScope.SubScope("param_" + strconv.Itoa(i))
+		yWs[i] = weightedSum(paramScope.SubScope("y_w"), ys[i])
+		zWs[i] = weightedSum(paramScope.SubScope("z_w"), zs[i])
+		squares := make([]tf.Output, popSize)
+		for k := range squares {
+			squares[k] = op.Square(paramScope.SubScope("y_sqr"), ys[i][k])
+		}
+		yWSqrs[i] = weightedSum(paramScope.SubScope("y_sqr_w"), squares)
+		oldSigmaPath := op.ReadVariableOp(paramScope.SubScope("sigma_path"), sigmaPaths[i], tf.Float)
+		newSigmaPaths[i] = op.Add(paramScope.SubScope("sigma_path"),
+			op.Mul(paramScope.SubScope("sigma_path_decay"), oldSigmaPath, c("c_sigma_decay", 1-consts.cSigma)),
+			op.Mul(paramScope.SubScope("sigma_path_z"), zWs[i], c("c_sigma_z", math.Sqrt(consts.cSigma*(2-consts.cSigma)*consts.muEff))),
+		)
+		sigmaPathSqrs = append(sigmaPathSqrs, op.Sum(paramScope.SubScope("sigma_path_sqr"), op.Square(paramScope, newSigmaPaths[i]), op.Const(paramScope.SubScope("sum_dims"), int32(0))))
+	}
+	sigmaPathNorm := op.Sqrt(stepScope.SubScope("sigma_path_norm"), op.AddN(stepScope.SubScope("sigma_path_norm"), sigmaPathSqrs))
+	// hSigma stalls the update of the covariance path when the step size is growing fast.
+	genFloat := op.Cast(stepScope.SubScope("gen_float"), nextGen, tf.Float)
+	correction := op.Sqrt(stepScope.SubScope("correction"), op.Sub(stepScope.SubScope("correction"),
+		c("one", 1),
+		op.Pow(stepScope.SubScope("correction"), c("c_sigma_decay_pow", 1-consts.cSigma), op.Mul(stepScope.SubScope("correction"), c("two", 2), genFloat)),
+	))
+	hSigma := op.Cast(stepScope.SubScope("h_sigma"),
+		op.Less(stepScope.SubScope("h_sigma"), op.Div(stepScope.SubScope("h_sigma"), sigmaPathNorm, correction), c("h_sigma_threshold", (1.4+2/float64(n+1))*consts.chiN)),
+		tf.Float,
+	)
+	covPathScale := op.Mul(stepScope.SubScope("cov_path_scale"), hSigma, c("c_c_y", math.Sqrt(consts.cC*(2-consts.cC)*consts.muEff)))
+	covCorrection := op.Mul(stepScope.SubScope("cov_correction"), op.Sub(stepScope.SubScope("cov_correction"), c("one", 1), hSigma), c("c_c_correction", consts.cC*(2-consts.cC)))
+
+	// and finally update everything.
+	step := []*tf.Operation{}
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			continue
+		}
+		paramScope := stepScope.SubScope("update_" + strconv.Itoa(i))
+		oldCovPath := op.ReadVariableOp(paramScope.SubScope("cov_path"), covPaths[i], tf.Float)
+		newCovPath := op.Add(paramScope.SubScope("cov_path"),
+			op.Mul(paramScope.SubScope("cov_path_decay"), oldCovPath, c("c_c_decay", 1-consts.cC)),
+			op.Mul(paramScope.SubScope("cov_path_y"), yWs[i], covPathScale),
+		)
+		rankOne := op.Add(paramScope.SubScope("rank_one"), op.Square(paramScope, newCovPath), op.Mul(paramScope.SubScope("rank_one"), oldCovs[i], covCorrection))
+		newCov := op.AddN(paramScope.SubScope("cov"), []tf.Output{
+			op.Mul(paramScope.SubScope("cov_decay"), oldCovs[i], c("cov_decay", 1-consts.c1-consts.cMu)),
+			op.Mul(paramScope.SubScope("cov_rank_one"), rankOne, c("c_1", consts.c1)),
+			op.Mul(paramScope.SubScope("cov_rank_mu"), yWSqrs[i], c("c_mu", consts.cMu)),
+		})
+		meanStep := op.Reshape(paramScope, op.Mul(paramScope.SubScope("mean_step"), yWs[i], sigmaOutput), paramShapes[i])
+		step = append(step,
+			op.AssignAddVariableOp(paramScope.SubScope("mean"), means[i], meanStep),
+			op.AssignVariableOp(paramScope.SubScope("cov"), covs[i], newCov),
+			op.AssignVariableOp(paramScope.SubScope("sigma_path"), sigmaPaths[i], newSigmaPaths[i]),
+			op.AssignVariableOp(paramScope.SubScope("cov_path"), covPaths[i], newCovPath),
+		)
+	}
+	sigmaChange := op.Exp(stepScope.SubScope("sigma"), op.Mul(stepScope.SubScope("sigma"),
+		op.Sub(stepScope.SubScope("sigma"), op.Div(stepScope.SubScope("sigma"), sigmaPathNorm, c("chi_n", consts.chiN)), c("one", 1)),
+		c("c_sigma_damping", consts.cSigma/consts.dSigma),
+	))
+	step = append(step,
+		op.AssignVariableOp(stepScope.SubScope("sigma"), sigmaVar, op.Mul(stepScope.SubScope("sigma"), sigmaOutput, sigmaChange)),
+		op.AssignVariableOp(stepScope.SubScope("generation"), generationVar, nextGen),
+	)
+	makeCMAES = func(sess *tf.Session) (sm CMAES, err error) {
+		_, err = sess.Run(nil, nil, initOps)
+		if err != nil {
+			return
+		}
+		sm = CMAES{
+			sess:     sess,
+			step:     step,
+			bestLoss: bestLoss,
+			sigma:    sigmaOutput,
+			params:   params,
+		}
+		return
+	}
+	return
+}
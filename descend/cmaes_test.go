@@ -0,0 +1,74 @@
+package descend
+
+import (
+	"testing"
+
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestCMAESConsts(t *testing.T) {
+	c := makeCMAESConsts(10, 10)
+	var sum float32
+	for i, w := range c.weights {
+		sum += w
+		if i > 0 && w > c.weights[i-1] {
+			t.Fatal("weights should be decreasing", c.weights)
+		}
+	}
+	if len(c.weights) != 5 || sum < 0.999 || sum > 1.001 {
+		t.Fatal("bad weights", c.weights)
+	}
+	if c.c1+c.cMu > 1 {
+		t.Fatal("learning rates are too large", c.c1, c.cMu)
+	}
+}
+
+func TestCMAEStrain(t *testing.T) {
+	s := op.NewScope()
+	lossFunc, paramDefs := makeOptimizerLoss(s)
+	makeCMAES, generation, params := NewCMAES(s.SubScope("cmaes"), paramDefs, lossFunc, 0, 0.5)
+	sess, _ := newTestSession(t, s)
+	sm, err := makeCMAES(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		err = sm.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := sess.Run(nil, append(params, generation), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[2].Value().(int64) != 300 || sm.Generation != 300 {
+		t.Fatal("bad generation", results[2].Value(), sm.Generation)
+	}
+	checkFitted(t, readParams(t, sess, params))
+	if sm.Loss > 0.01 {
+		t.Fatal("loss is too high", sm.Loss)
+	}
+}
+
+func TestCMAESFrozen(t *testing.T) {
+	s := op.NewScope()
+	lossFunc, paramDefs := makeOptimizerLoss(s)
+	paramDefs[1].Frozen = true
+	makeCMAES, _, params := NewCMAES(s.SubScope("cmaes"), paramDefs, lossFunc, 0, 0.5)
+	sess, _ := newTestSession(t, s)
+	sm, err := makeCMAES(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err = sm.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := readParams(t, sess, params)
+	if values[0].(float32) == 0 || values[1].(float32) != 0 {
+		t.Fatal("only the weight should have moved", values)
+	}
+}
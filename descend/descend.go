@@ -1,14 +1,19 @@
 // Package descend provides tools to use gradient descent to optimize the parameters of continuous functions implemented as tensorflow graphs.
-// It does not (yet) implement backpropagation, but rather uses ES and other black box optimization algorithms.
+// It mostly uses ES and other black box optimization algorithms, but GradientSM also implements backpropagation for comparison.
 package descend
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 
 	tf "github.com/tensorflow/tensorflow/tensorflow/go"
 	"github.com/tensorflow/tensorflow/tensorflow/go/op"
 )
 
+// ErrNothingToRewind is returned by Rewind when the state machine is at generation 0.
+var ErrNothingToRewind = errors.New("descend: nothing to rewind")
+
 // LossFunc takes a slice of params and returns the loss for the slice
 type LossFunc func(s *op.Scope, params []tf.Output) (loss tf.Output)
 
@@ -17,8 +22,21 @@ type NoiseFunc func(s *op.Scope, shape tf.Output, seed, gen tf.Output) tf.Output
 
 // ParamDef defines a shape and name
 type ParamDef struct {
-	Name string                    // Name must be unique
-	Init func(*op.Scope) tf.Output // Output of the initial state
+	Name       string                    // Name must be unique
+	Init       func(*op.Scope) tf.Output // Output of the initial state
+	NoiseScale float32                   // Scales the noise of this param relative to the others, or for CMA-ES its initial standard deviation. 0 means 1. GradientSM ignores it.
+	Frozen     bool                      // Frozen params keep their initial state; no state machine perturbs or updates them.
+}
+
+// paramNoise returns noise, scaled by the NoiseScale of the param.
+func (pd ParamDef) paramNoise(noise NoiseFunc) NoiseFunc {
+	if pd.NoiseScale == 0 || pd.NoiseScale == 1 {
+		return noise
+	}
+	return func(s *op.Scope, shape tf.Output, seed, gen tf.Output) tf.Output {
+		scaleScope := s.SubScope("noise_scale")
+		return op.Mul(scaleScope, noise(s, shape, seed, gen), op.Const(scaleScope.SubScope("scale"), pd.NoiseScale))
+	}
 }
 
 // ModelDef defines a model.
@@ -40,22 +58,146 @@ func MakeNoise(stdevVal float32) NoiseFunc {
 	}
 }
 
+// perturbParams adds the noise which the seed would add to each of the params at generation gen, scaled by sigma.
+// If mirror is set, it also returns the params with the noise subtracted. Frozen params are returned as they are.
+func perturbParams(s *op.Scope, noise NoiseFunc, scheme SeedScheme, paramDefs []ParamDef, params []tf.Output, seed, gen, sigma tf.Output, mirror bool) (perturbed, mirrored []tf.Output) {
+	perturbed = make([]tf.Output, len(params))
+	if mirror {
+		mirrored = make([]tf.Output, len(params))
+	}
+	for i, param := range params {
+		if paramDefs[i].Frozen {
+			perturbed[i] = param
+			if mirror {
+				mirrored[i] = param
+			}
+			continue
+		}
+		paramScope := s.SubScope("param_" + strconv.Itoa(i))
+		paramShape := op.Shape(paramScope.SubScope("input"), param, op.ShapeOutType(tf.Int32))
+		seedNoise := paramDefs[i].paramNoise(noise)(paramScope.SubScope("perturb_noise"), paramShape, paramSeed(paramScope, scheme, seed, i, paramDefs[i].Name), gen)
+		seedNoise = op.Mul(paramScope.SubScope("sigma"), seedNoise, sigma)
+		perturbed[i] = op.Add(paramScope.SubScope("perturb"), param, seedNoise)
+		if mirror {
+			mirrored[i] = op.Sub(paramScope.SubScope("mirror"), param, seedNoise)
+		}
+	}
+	return
+}
+
+// SeedWeightsOption changes how newSeedWeights calculates the weights of the seeds.
+type SeedWeightsOption func(*seedWeightsConfig)
+
+type seedWeightsConfig struct {
+	mirrored bool
+	shaping  FitnessShaping
+	graph    *FitnessGraph
+	behavior BehaviorFunc
+}
+
+// Mirrored makes newSeedWeights evaluate both params+noise and params-noise for each seed, and weight each seed by half the difference in loss.
+// This doubles the cost of evaluating the seeds, but gives a lower variance estimate of the gradient for the same number of noise draws.
+func Mirrored() SeedWeightsOption {
+	return func(c *seedWeightsConfig) {
+		c.mirrored = true
+	}
+}
+
+// FitnessGraph holds the parts of the graph which newSeedWeights or newBestSeed builds, so that the seeds can be evaluated in one place, and weighted in another.
+// With ChunkedEval, there is no SeedFitness, but SeedIndices can be fed a chunk of seeds to get their ChunkFitness.
+type FitnessGraph struct {
+	SeedFitness  []tf.Output // how much each seed improved the loss, before shaping.
+	Fitness      tf.Output   // SeedFitness packed into one vector. Feed it to get Weights without evaluating the seeds.
+	Weights      tf.Output   // the weights of the seeds.
+	SeedIndices  tf.Output   // a placeholder for the indices of a chunk of seeds.
+	ChunkFitness tf.Output   // the fitness of the chunk of seeds fed to SeedIndices.
+	// With WithBehavior, the behavior of each seed, or of each seed of the chunk.
+	SeedBehavior  []tf.Output
+	ChunkBehavior tf.Output
+	numSeeds      int
+	chunkSize     int
+	// the fitness depends on these, so they are read from one session and fed to others.
+	params     []tf.Output
+	generation tf.Output
+	sigma      tf.Output
+}
+
+// ExportFitnessGraph makes newSeedWeights or newBestSeed fill in graph with the outputs it builds.
+func ExportFitnessGraph(graph *FitnessGraph) SeedWeightsOption {
+	return func(c *seedWeightsConfig) {
+		c.graph = graph
+	}
+}
+
+// SMOption changes how a state machine is built.
+type SMOption func(*smConfig)
+
+type smConfig struct {
+	updateRule UpdateRule
+	sigma      float32
+	schedule   SigmaSchedule
+	chunkSize  int
+	seedScheme SeedScheme
+	emaDecay   float32
+	emaParams  *[]tf.Output
+}
+
+func makeSMConfig(options []SMOption) (config smConfig) {
+	config = smConfig{sigma: 1, seedScheme: HashedSeeds}
+	for _, option := range options {
+		option(&config)
+	}
+	return
+}
+
+// WithUpdateRule makes NewWeightedSeedSM treat the weighted sum of the noise as an estimate of the gradient, and apply it with rule.
+// Without it, the weighted sum is added to the params as it is.
+func WithUpdateRule(rule UpdateRule) SMOption {
+	return func(c *smConfig) {
+		c.updateRule = rule
+	}
+}
+
 // SeedSM allows one to move through the parameter space using seeds.
 type SeedSM struct {
 	Generation       int64
 	Seeds            []int64
+	Sigma            float32   // the sigma which the next step will use.
+	Sigmas           []float32 // the sigma which each step used.
 	perturb          []*tf.Operation
 	deperturb        []*tf.Operation
 	sess             *tf.Session
 	seedPH           tf.Output
 	genPH            tf.Output
 	updateGeneration *tf.Operation
+	sigmaPH          tf.Output
+	updateSigma      *tf.Operation
+	schedule         SigmaSchedule
+	initOps          []*tf.Operation
+	params           []tf.Output
+	seedScheme       SeedScheme
+	ema              paramEMA
+	noiseProbe       []tf.Output
+	rewound          bool // a rewind has subtracted noise since the last replay, so the params may differ from those of the lineage by rounding.
 }
 
 // Step moves the parameters through parameter space by one seed
 func (sm *SeedSM) Step(seed int64) (err error) {
+	err = sm.step(seed, sm.Sigma)
+	if err != nil {
+		return
+	}
+	if sm.schedule != nil {
+		err = sm.SetSigma(sm.schedule(sm.Generation + 1))
+	}
+	return
+}
+
+// step moves the parameters by one seed, with the noise scaled by sigma.
+func (sm *SeedSM) step(seed int64, sigma float32) (err error) {
 	sm.Generation++
 	sm.Seeds = append(sm.Seeds, seed)
+	sm.Sigmas = append(sm.Sigmas, sigma)
 	seedTensor, err := tf.NewTensor(seed)
 	if err != nil {
 		panic(err)
@@ -64,15 +206,37 @@ func (sm *SeedSM) Step(seed int64) (err error) {
 	if err != nil {
 		panic(err)
 	}
-	_, err = sm.sess.Run(map[tf.Output]*tf.Tensor{sm.seedPH: seedTensor, sm.genPH: genTensor}, nil, append(sm.perturb, sm.updateGeneration))
+	sigmaTensor, err := tf.NewTensor(sigma)
+	if err != nil {
+		panic(err)
+	}
+	_, err = sm.sess.Run(map[tf.Output]*tf.Tensor{sm.seedPH: seedTensor, sm.genPH: genTensor, sm.sigmaPH: sigmaTensor}, nil, append(append(sm.perturb, sm.updateGeneration), sm.ema.save...))
 	if err != nil {
 		return
 	}
+	err = sm.ema.stepped(sm.sess)
+	return
+}
+
+// SetSigma sets the sigma by which the noise of the next step, and of the seeds being evaluated, will be scaled.
+func (sm *SeedSM) SetSigma(sigma float32) (err error) {
+	err = setSigma(sm.sess, sm.sigmaPH, sm.updateSigma, sigma)
+	if err != nil {
+		return
+	}
+	sm.Sigma = sigma
 	return
 }
 
 // Rewind steps back by one step,
 func (sm *SeedSM) Rewind() (err error) {
+	if len(sm.Seeds) == 0 {
+		return ErrNothingToRewind
+	}
+	if sm.ema.needsReplay() { // the moving averages can only undo one step.
+		last := len(sm.Seeds) - 1
+		return sm.replay(sm.Seeds[:last], sm.Sigmas[:last], sm.Sigmas[last])
+	}
 	seedTensor, err := tf.NewTensor(sm.Seeds[len(sm.Seeds)-1])
 	if err != nil {
 		panic(err)
@@ -82,12 +246,88 @@ func (sm *SeedSM) Rewind() (err error) {
 	if err != nil {
 		panic(err)
 	}
-	_, err = sm.sess.Run(map[tf.Output]*tf.Tensor{sm.seedPH: seedTensor, sm.genPH: genTensor}, nil, append(sm.deperturb, sm.updateGeneration))
+	sigma := sm.Sigmas[len(sm.Sigmas)-1]
+	sigmaTensor, err := tf.NewTensor(sigma)
+	if err != nil {
+		panic(err)
+	}
+	err = sm.ema.rewind(sm.sess)
+	if err != nil {
+		return
+	}
+	_, err = sm.sess.Run(map[tf.Output]*tf.Tensor{sm.seedPH: seedTensor, sm.genPH: genTensor, sm.sigmaPH: sigmaTensor}, nil, sm.deperturb)
 	if err != nil {
 		return
 	}
+	sm.rewound = true
 	sm.Generation += -1
 	sm.Seeds = sm.Seeds[:len(sm.Seeds)-1]
+	sm.Sigmas = sm.Sigmas[:len(sm.Sigmas)-1]
+	err = setGeneration(sm.sess, sm.genPH, sm.updateGeneration, sm.Generation)
+	if err != nil {
+		return
+	}
+	err = sm.SetSigma(sigma) // the next step should use the same sigma as the step which was undone.
+	return
+}
+
+// replay resets the params, steps through seeds with the given sigmas, and then sets sigma for the next step.
+func (sm *SeedSM) replay(seeds []int64, sigmas []float32, sigma float32) (err error) {
+	_, err = sm.sess.Run(nil, nil, sm.initOps)
+	if err != nil {
+		return
+	}
+	sm.Generation = 0
+	sm.Seeds = nil
+	sm.Sigmas = nil
+	sm.ema.undoable = false
+	sm.rewound = false
+	for i, seed := range seeds {
+		err = sm.step(seed, sigmas[i])
+		if err != nil {
+			return
+		}
+	}
+	err = sm.SetSigma(sigma)
+	return
+}
+
+// resync replays the lineage if a rewind has subtracted noise since the last replay, so that the params are exactly those which a replay of it makes.
+func (sm *SeedSM) resync() (err error) {
+	if !sm.rewound {
+		return
+	}
+	return sm.replay(sm.Seeds, sm.Sigmas, sm.Sigma)
+}
+
+// setGeneration sets the generation variable to gen.
+// The noise of a rewind must be made with the generation being rewound, so the variable must be set separately afterwards.
+func setGeneration(sess *tf.Session, genPH tf.Output, updateGeneration *tf.Operation, gen int64) (err error) {
+	genTensor, err := tf.NewTensor(gen)
+	if err != nil {
+		panic(err)
+	}
+	_, err = sess.Run(map[tf.Output]*tf.Tensor{genPH: genTensor}, nil, []*tf.Operation{updateGeneration})
+	return
+}
+
+// makeSigma makes a placeholder to feed sigma to the perturb ops, and a variable to store it so that the seed evaluators can read it.
+func makeSigma(s *op.Scope, name string, initial float32) (sigmaPH, sigma tf.Output, updateSigma, initSigma *tf.Operation) {
+	sigmaPH = op.Placeholder(s.SubScope("ph"), tf.Float, op.PlaceholderShape(tf.ScalarShape()))
+	sigmaVar := op.VarHandleOp(s, tf.Float, tf.ScalarShape(), op.VarHandleOpSharedName(name))
+	updateSigma = op.AssignVariableOp(s, sigmaVar, sigmaPH)
+	initSigma = op.AssignVariableOp(s.SubScope("init"), sigmaVar, op.Const(s.SubScope("initial"), initial))
+	sigma = op.ReadVariableOp(s, sigmaVar, tf.Float)
+	return
+}
+
+// setSigma sets the sigma variable.
+func setSigma(sess *tf.Session, sigmaPH tf.Output, updateSigma *tf.Operation, sigma float32) (err error) {
+	sigmaTensor, err := tf.NewTensor(sigma)
+	if err != nil {
+		panic(err)
+	}
+	_, err = sess.Run(map[tf.Output]*tf.Tensor{sigmaPH: sigmaTensor}, nil, []*tf.Operation{updateSigma})
 	return
 }
 
@@ -97,84 +337,162 @@ func NewSeedSM(s *op.Scope,
 	noise NoiseFunc,
 	paramDefs []ParamDef,
 	numSeeds int,
+	options ...SMOption,
 ) (
 	makeSeedSM func(*tf.Session) (SeedSM, error),
-	newBestSeed func(LossFunc) func(*tf.Session) (func() (int64, error), error),
+	newBestSeed func(LossFunc, ...SeedWeightsOption) func(*tf.Session) (func() (int64, error), error),
 	generation tf.Output,
 	params []tf.Output,
 ) {
+	config := makeSMConfig(options)
+	ns := namespace(s, "NewSeedSM", paramDefs)
+	seedScheme := config.seedScheme
+	chunkSize := config.chunkSize
+	if chunkSize > numSeeds {
+		chunkSize = numSeeds
+	}
 	// we make two place holders for the go code to pass the seed, and the generation at run time.
 	seed := op.Placeholder(s.SubScope("seed"), tf.Int64, op.PlaceholderShape(tf.ScalarShape()))
 	gen := op.Placeholder(s.SubScope("gen"), tf.Int64, op.PlaceholderShape(tf.ScalarShape()))
 	// also store the generation in a tf variable so that bestSeed can read it.
 	generationScope := s.SubScope("generation")
-	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName("generation"))
+	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "generation")))
 	updateGeneration := op.AssignVariableOp(generationScope, generationVar, gen)
 	initGeneration := op.AssignVariableOp(generationScope.SubScope("init"), generationVar, op.Const(generationScope.SubScope("zero"), int64(0)))
 	generation = op.ReadVariableOp(generationScope, generationVar, tf.Int64)
+	// and the same for sigma.
+	sigmaPH, sigma, updateSigma, initSigma := makeSigma(s.SubScope("sigma"), sharedName(ns, "sigma"), config.sigma)
 
 	paramCount := len(paramDefs) // number of params
 	// Now we create slices to hold various things for each param.
 	varHandles := make([]tf.Output, paramCount)     // handles to the actual variables
 	params = make([]tf.Output, paramCount)          // outputs to read the value of the params
 	initParams := make([]*tf.Operation, paramCount) // operations to initialise the variables with zeros
-	perturb := make([]*tf.Operation, paramCount)    // for perturbing according to the given seed.
-	deperturb := make([]*tf.Operation, paramCount)  // for deperturbing according to the seed poped off the stack.
+	initVals := make([]tf.Output, paramCount)       // the initial values of the params, for the moving averages.
+	perturb := []*tf.Operation{}                    // for perturbing according to the given seed.
+	deperturb := []*tf.Operation{}                  // for deperturbing according to the seed poped off the stack.
 	for i, pd := range paramDefs {                  // for each tensor of params,
 		paramScope := s.SubScope(pd.Name)
-		paramIndex := op.Const(s.SubScope("param_index"), int64(i)) // the index of that param.
 		zeroParam := pd.Init(paramScope.SubScope("init_val"))
-		varHandles[i] = op.VarHandleOp(paramScope, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(pd.Name))
+		initVals[i] = zeroParam
+		varHandles[i] = op.VarHandleOp(paramScope, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name)))
 		initParams[i] = op.AssignVariableOp(paramScope, varHandles[i], zeroParam)      // OPs to initialize the param tensors.
 		params[i] = op.ReadVariableOp(paramScope, varHandles[i], zeroParam.DataType()) // OPs to read them
-		// we sum the seed with the index of the parameter tensor as a hack to prevent two parameter tensors of the same shape from being the same.
-		paramSeed := op.Add(paramScope.SubScope("inc_seed"), seed, paramIndex)
-		seedNoise := noise(paramScope.SubScope("perturb_noise"), op.Shape(paramScope, zeroParam), paramSeed, gen)
-		perturb[i] = op.AssignAddVariableOp(paramScope.SubScope("perturb"), varHandles[i], seedNoise)
-		deperturb[i] = op.AssignSubVariableOp(paramScope.SubScope("deperturb"), varHandles[i], seedNoise)
+		if pd.Frozen {
+			continue
+		}
+		seedNoise := op.Mul(paramScope.SubScope("sigma"), pd.paramNoise(noise)(paramScope.SubScope("perturb_noise"), op.Shape(paramScope, zeroParam), paramSeed(paramScope, seedScheme, seed, i, pd.Name), gen), sigmaPH)
+		perturb = append(perturb, op.AssignAddVariableOp(paramScope.SubScope("perturb"), varHandles[i], seedNoise))
+		deperturb = append(deperturb, op.AssignSubVariableOp(paramScope.SubScope("deperturb"), varHandles[i], seedNoise))
+	}
+	noiseProbe := makeNoiseProbe(s.SubScope("noise_probe"), noise, seedScheme, paramDefs, initVals)
+	var ema paramEMA
+	if config.emaParams != nil {
+		var initEMA []*tf.Operation
+		*config.emaParams, ema, initEMA = makeParamEMA(s.SubScope("ema"), ns, config.emaDecay, paramDefs, params, initVals)
+		initParams = append(initParams, initEMA...)
 	}
 	// Once the user finalizes the scope and gives us session we can run the initialization OPs and construct the state SeedSM struct.
 	makeSeedSM = func(sess *tf.Session) (sm SeedSM, err error) {
-		_, err = sess.Run(nil, nil, append(initParams, initGeneration))
+		initOps := append(initParams, initGeneration, initSigma)
+		_, err = sess.Run(nil, nil, initOps)
+		if err != nil {
+			return
+		}
 		sm = SeedSM{
+			Sigma:            config.sigma,
 			sess:             sess,
 			perturb:          perturb,
 			deperturb:        deperturb,
 			seedPH:           seed,
 			genPH:            gen,
 			updateGeneration: updateGeneration,
+			sigmaPH:          sigmaPH,
+			updateSigma:      updateSigma,
+			schedule:         config.schedule,
+			seedScheme:       seedScheme,
+			initOps:          initOps,
+			params:           params,
+			ema:              ema,
+			noiseProbe:       noiseProbe,
+		}
+		if sm.schedule != nil {
+			err = sm.SetSigma(sm.schedule(1))
 		}
 		return
 	}
 	// If the user also wants to search for the next best seed, they can run this func.
-	newBestSeed = func(lossFunc LossFunc) (makeBestSeed func(*tf.Session) (func() (int64, error), error)) {
+	// Of the SeedWeightsOptions, only ExportFitnessGraph and WithBehavior are used. The fitness of each seed is the negative of its loss, and there are no weights.
+	newBestSeed = func(lossFunc LossFunc, options ...SeedWeightsOption) (makeBestSeed func(*tf.Session) (func() (int64, error), error)) {
+		config := seedWeightsConfig{}
+		for _, option := range options {
+			option(&config)
+		}
 		bestSeedScope := s.SubScope("best_seed")
-		paramCount := len(params) // number of params
 		seedLosses := make([]tf.Output, numSeeds)
-		one := op.Const(bestSeedScope.SubScope("one"), int64(1)) // needed later
+		one := op.Const(bestSeedScope.SubScope("one"), int64(1))              // needed later
+		nextGen := op.Add(bestSeedScope.SubScope("inc_gen"), generation, one) // this is a hack to get the generation to be correct.
+		// seedLoss makes the loss, and if wanted the behavior, of the params perturbed by one seed.
+		seedLoss := func(seedScope *op.Scope, seed tf.Output) (loss, behavior tf.Output) {
+			perturbedParams, _ := perturbParams(seedScope, noise, seedScheme, paramDefs, params, seed, nextGen, sigma, false)
+			loss = lossFunc(seedScope.SubScope("model"), perturbedParams)
+			if config.behavior != nil {
+				behavior = config.behavior(seedScope.SubScope("behavior"), perturbedParams)
+			}
+			return
+		}
+		fitnessGraph := FitnessGraph{numSeeds: numSeeds, chunkSize: chunkSize, params: params, generation: generation, sigma: sigma}
+		if chunkSize > 0 { // evaluate the seeds a chunk at a time through one copy of the model.
+			chunkScope := bestSeedScope.SubScope("chunk")
+			indices, seeds := makeSeedIndices(chunkScope, chunkSize)
+			chunkLosses := make([]tf.Output, chunkSize)
+			chunkBehaviors := make([]tf.Output, chunkSize)
+			for i, seed := range seeds {
+				chunkLosses[i], chunkBehaviors[i] = seedLoss(chunkScope.SubScope("child"+strconv.Itoa(i)), seed)
+			}
+			fitnessGraph.SeedIndices = indices
+			fitnessGraph.ChunkFitness = op.Neg(chunkScope, op.Pack(chunkScope.SubScope("pack"), chunkLosses))
+			if config.behavior != nil {
+				fitnessGraph.ChunkBehavior = op.Pack(chunkScope.SubScope("pack_behavior"), chunkBehaviors)
+			}
+			if config.graph != nil {
+				*config.graph = fitnessGraph
+			}
+			makeBestSeed = func(sess *tf.Session) (bestSeed func() (int64, error), err error) {
+				evaluate, _ := MakeFitnessFuncs(sess, fitnessGraph)
+				bestSeed = func() (seed int64, err error) {
+					fitness, err := evaluate(seedRange(numSeeds))
+					if err != nil {
+						return
+					}
+					seed = fittestSeed(fitness)
+					return
+				}
+				return
+			}
+			return
+		}
+		seedBehaviors := make([]tf.Output, numSeeds)
 		// for each seed,
 		for seedIndex := 0; seedIndex < numSeeds; seedIndex++ {
 			seedScope := bestSeedScope.SubScope("child" + strconv.Itoa(seedIndex))
 			seed := op.Const(seedScope.SubScope("seed"), int64(seedIndex))
-			perturbedParams := make([]tf.Output, paramCount)
-			// for each param,
-			for i, param := range params {
-				paramScope := seedScope.SubScope("param_" + strconv.Itoa(i))
-				paramShape := op.Shape(paramScope.SubScope("input"), param, op.ShapeOutType(tf.Int32))
-				paramIndex := op.Const(paramScope.SubScope("param_index"), int64(i))
-				paramSeed := op.Add(paramScope.SubScope("inc_seed"), seed, paramIndex)
-				seedNoise := noise(paramScope.SubScope("perturb_noise"),
-					paramShape,
-					paramSeed,
-					op.Add(paramScope.SubScope("inc_gen"), generation, one), // this is a hack to get the generation to be correct.
-				)
-				perturbedParam := op.Add(paramScope, params[i], seedNoise)
-				perturbedParams[i] = perturbedParam
-			}
-			seedLosses[seedIndex] = lossFunc(seedScope.SubScope("model"), perturbedParams)
+			seedLosses[seedIndex], seedBehaviors[seedIndex] = seedLoss(seedScope, seed)
 		}
 		losses := op.Pack(bestSeedScope.SubScope("pack"), seedLosses)
 		lowestSeed := op.ArgMin(bestSeedScope, losses, op.Const(bestSeedScope.SubScope("argmin_dims"), int32(0)), op.ArgMinOutputType(tf.Int64))
+		if config.graph != nil { // only build the fitness if someone wants it.
+			fitnessScope := bestSeedScope.SubScope("fitness")
+			fitnessGraph.SeedFitness = make([]tf.Output, numSeeds)
+			for i, loss := range seedLosses {
+				fitnessGraph.SeedFitness[i] = op.Neg(fitnessScope, loss)
+			}
+			fitnessGraph.Fitness = op.Neg(fitnessScope, losses)
+			if config.behavior != nil {
+				fitnessGraph.SeedBehavior = seedBehaviors
+			}
+			*config.graph = fitnessGraph
+		}
 		// once the user has given us the session, we can make the bestSeed func.
 		makeBestSeed = func(sess *tf.Session) (bestSeed func() (int64, error), err error) {
 			// Nothing needs to be finalized this time.
@@ -195,33 +513,156 @@ func NewSeedSM(s *op.Scope,
 
 // Step moves the parameters through parameter space by one list of weights
 func (sm *WeightedSeedSM) Step(weights []float32) (err error) {
+	err = sm.step(weights, sm.Sigma)
+	if err != nil {
+		return
+	}
+	if sm.schedule != nil {
+		err = sm.SetSigma(sm.schedule(sm.Generation + 1))
+	}
+	return
+}
+
+// step moves the parameters by one list of weights, with the noise scaled by sigma.
+func (sm *WeightedSeedSM) step(weights []float32, sigma float32) (err error) {
+	if len(weights) != sm.numSeeds {
+		return fmt.Errorf("descend: got %d seed weights but state machine has %d seeds", len(weights), sm.numSeeds)
+	}
 	sm.Generation++
 	sm.SeedWeights = append(sm.SeedWeights, weights)
-	weightsTensor, err := tf.NewTensor(weights)
+	sm.Sigmas = append(sm.Sigmas, sigma)
+	err = sm.runWeighted(weights, sigma, append(append(sm.perturb, sm.updateGeneration), sm.ema.save...))
 	if err != nil {
-		panic(err)
+		return
 	}
+	err = sm.ema.stepped(sm.sess)
+	return
+}
+
+// runWeighted runs targets with the noise of the seeds at the current generation, weighted by weights and scaled by sigma.
+// With ChunkedEval, the weighted noise is first summed a chunk of seeds at a time.
+func (sm *WeightedSeedSM) runWeighted(weights []float32, sigma float32, targets []*tf.Operation) (err error) {
 	genTensor, err := tf.NewTensor(sm.Generation)
 	if err != nil {
 		panic(err)
 	}
-	_, err = sm.sess.Run(map[tf.Output]*tf.Tensor{sm.weightsPH: weightsTensor, sm.genPH: genTensor}, nil, append(sm.perturb, sm.updateGeneration))
+	sigmaTensor, err := tf.NewTensor(sigma)
+	if err != nil {
+		panic(err)
+	}
+	feeds := map[tf.Output]*tf.Tensor{sm.genPH: genTensor, sm.sigmaPH: sigmaTensor}
+	if sm.chunks.size > 0 {
+		err = sm.chunks.sum(sm.sess, genTensor, weights)
+		if err != nil {
+			return
+		}
+	} else {
+		var weightsTensor *tf.Tensor
+		weightsTensor, err = tf.NewTensor(weights)
+		if err != nil {
+			panic(err)
+		}
+		feeds[sm.weightsPH] = weightsTensor
+	}
+	_, err = sm.sess.Run(feeds, nil, targets)
+	return
+}
+
+// SetSigma sets the sigma by which the noise of the next step, and of the seeds being evaluated, will be scaled.
+func (sm *WeightedSeedSM) SetSigma(sigma float32) (err error) {
+	err = setSigma(sm.sess, sm.sigmaPH, sm.updateSigma, sigma)
 	if err != nil {
 		return
 	}
+	sm.Sigma = sigma
 	return
 }
 
+// Rewind steps back by one step, undoing the last list of weights.
+// If the state machine has an update rule with state, the params are rebuilt by replaying all but the last step.
+func (sm *WeightedSeedSM) Rewind() (err error) {
+	if len(sm.SeedWeights) == 0 {
+		return ErrNothingToRewind
+	}
+	last := len(sm.SeedWeights) - 1
+	sigma := sm.Sigmas[last]
+	if sm.replayRewind || sm.ema.needsReplay() {
+		return sm.replay(sm.SeedWeights[:last], sm.Sigmas[:last], sigma)
+	}
+	err = sm.ema.rewind(sm.sess)
+	if err != nil {
+		return
+	}
+	err = sm.runWeighted(sm.SeedWeights[last], sigma, sm.deperturb)
+	if err != nil {
+		return
+	}
+	sm.rewound = true
+	sm.Generation += -1
+	sm.SeedWeights = sm.SeedWeights[:last]
+	sm.Sigmas = sm.Sigmas[:last]
+	err = setGeneration(sm.sess, sm.genPH, sm.updateGeneration, sm.Generation)
+	if err != nil {
+		return
+	}
+	err = sm.SetSigma(sigma) // the next step should use the same sigma as the step which was undone.
+	return
+}
+
+// replay resets the params, steps through seedWeights with the given sigmas, and then sets sigma for the next step.
+func (sm *WeightedSeedSM) replay(seedWeights [][]float32, sigmas []float32, sigma float32) (err error) {
+	_, err = sm.sess.Run(nil, nil, sm.initOps)
+	if err != nil {
+		return
+	}
+	sm.Generation = 0
+	sm.SeedWeights = nil
+	sm.Sigmas = nil
+	sm.ema.undoable = false
+	sm.rewound = false
+	for i, weights := range seedWeights {
+		err = sm.step(weights, sigmas[i])
+		if err != nil {
+			return
+		}
+	}
+	err = sm.SetSigma(sigma)
+	return
+}
+
+// resync replays the lineage if a rewind has subtracted noise since the last replay, so that the params are exactly those which a replay of it makes.
+func (sm *WeightedSeedSM) resync() (err error) {
+	if !sm.rewound {
+		return
+	}
+	return sm.replay(sm.SeedWeights, sm.Sigmas, sm.Sigma)
+}
+
 // WeightedSeedSM allows one to move through the parameter space using a list of seed weights.
 type WeightedSeedSM struct {
 	Generation       int64
 	SeedWeights      [][]float32
+	Sigma            float32   // the sigma which the next step will use.
+	Sigmas           []float32 // the sigma which each step used.
 	perturb          []*tf.Operation
 	deperturb        []*tf.Operation
 	sess             *tf.Session
 	weightsPH        tf.Output
 	genPH            tf.Output
 	updateGeneration *tf.Operation
+	sigmaPH          tf.Output
+	updateSigma      *tf.Operation
+	schedule         SigmaSchedule
+	initOps          []*tf.Operation
+	params           []tf.Output
+	numSeeds         int
+	replayRewind     bool // the update rule has state, so deperturb can not undo a step.
+	chunks           noiseChunks
+	rewound          bool // a rewind has subtracted noise since the last replay, so the params may differ from those of the lineage by rounding.
+	copier           varCopier
+	seedScheme       SeedScheme
+	ema              paramEMA
+	noiseProbe       []tf.Output
 }
 
 // NewWeightedSeedSM creates TF OPs for a state machine to move through parameter space according to the seed which is give and the generation.
@@ -230,94 +671,194 @@ func NewWeightedSeedSM(s *op.Scope,
 	noise NoiseFunc,
 	paramDefs []ParamDef,
 	numSeeds int,
+	options ...SMOption,
 ) (
 	makeSeedSM func(*tf.Session) (WeightedSeedSM, error),
-	newSeedWeights func(LossFunc, tf.Output) func(*tf.Session) (func() ([]float32, error), error),
+	newSeedWeights func(LossFunc, tf.Output, ...SeedWeightsOption) func(*tf.Session) (func() ([]float32, error), error),
 	generation tf.Output,
 	params []tf.Output,
 ) {
+	config := makeSMConfig(options)
+	ns := namespace(s, "NewWeightedSeedSM", paramDefs)
+	seedScheme := config.seedScheme
+	chunkSize := config.chunkSize
+	if chunkSize > numSeeds {
+		chunkSize = numSeeds
+	}
 	// we make two placeholders for the go code to pass the seed, and the generation at run time.
 	weights := op.Placeholder(s.SubScope("seed"), tf.Float, op.PlaceholderShape(tf.MakeShape(int64(numSeeds))))
 	gen := op.Placeholder(s.SubScope("gen"), tf.Int64, op.PlaceholderShape(tf.ScalarShape()))
 	// also store the generation in a tf variable so that bestSeed can read it.
 	generationScope := s.SubScope("generation")
-	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName("generation"))
+	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "generation")))
 	updateGeneration := op.AssignVariableOp(generationScope, generationVar, gen)
 	initGeneration := op.AssignVariableOp(generationScope.SubScope("init"), generationVar, op.Const(generationScope.SubScope("zero"), int64(0)))
 	generation = op.ReadVariableOp(generationScope, generationVar, tf.Int64)
+	// and the same for sigma.
+	sigmaPH, sigma, updateSigma, initSigma := makeSigma(s.SubScope("sigma"), sharedName(ns, "sigma"), config.sigma)
 
 	paramCount := len(paramDefs) // number of params
 	// Now we create slices to hold various things for each param.
 	varHandles := make([]tf.Output, paramCount)     // handles to the actual variables
 	params = make([]tf.Output, paramCount)          // outputs to read the value of the params
 	initParams := make([]*tf.Operation, paramCount) // operations to initialise the variables with zeros
-	perturb := make([]*tf.Operation, paramCount)    // for perturbing according to the given seed.
-	deperturb := make([]*tf.Operation, paramCount)  // for deperturbing according to the seed poped off the stack.
-	seedWeights := op.Unpack(s, weights, int64(numSeeds))
+	initVals := make([]tf.Output, paramCount)       // the initial values of the params, for the moving averages.
+	perturb := []*tf.Operation{}                    // for perturbing according to the given seed.
+	deperturb := []*tf.Operation{}                  // for deperturbing according to the seed poped off the stack.
+	stateUpdates := []*tf.Operation{}               // for updating the state of the update rule, if it has any.
+	initState := []*tf.Operation{}                  // for resetting the state of the update rule.
+	var seedWeights []tf.Output
+	var chunks noiseChunks
+	if chunkSize > 0 { // sum the noise of the seeds a chunk at a time, so the graph does not grow with numSeeds.
+		chunks = makeNoiseChunks(s.SubScope("step_chunk"), gen, chunkSize)
+	} else {
+		seedWeights = op.Unpack(s, weights, int64(numSeeds))
+	}
 	for i, pd := range paramDefs { // for each tensor of params,
 		paramScope := s.SubScope(pd.Name)
 		zeroParam := pd.Init(paramScope.SubScope("init_val"))
+		initVals[i] = zeroParam
 		paramShape := op.Shape(paramScope, zeroParam)
-		varHandles[i] = op.VarHandleOp(paramScope, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(pd.Name))
+		varHandles[i] = op.VarHandleOp(paramScope, zeroParam.DataType(), zeroParam.Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name)))
 		initParams[i] = op.AssignVariableOp(paramScope, varHandles[i], zeroParam)      // OPs to initialize the param tensors.
 		params[i] = op.ReadVariableOp(paramScope, varHandles[i], zeroParam.DataType()) // OPs to read them
-		noises := make([]tf.Output, numSeeds)
-		for s := range noises {
-			seedScope := paramScope.SubScope("seed_" + strconv.Itoa(s))
-			// we sum the seed with the index of the parameter tensor as a hack to prevent two parameter tensors of the same shape from being the same.
-			seed := op.Const(seedScope, int64(s+i))
-			seedNoise := noise(seedScope.SubScope("noise"), paramShape, seed, gen)
-			noises[s] = op.Mul(seedScope, seedNoise, seedWeights[s])
+		if pd.Frozen {
+			continue
+		}
+		paramNoise := pd.paramNoise(noise)
+		seedNoise := func(seedScope *op.Scope, seed tf.Output) tf.Output {
+			return paramNoise(seedScope.SubScope("noise"), paramShape, paramSeed(seedScope, seedScheme, seed, i, pd.Name), gen)
+		}
+		var noiseSum tf.Output
+		if chunkSize > 0 {
+			noiseSum = chunks.addParam(paramScope.SubScope("chunk"), sharedName(ns, pd.Name+"/step_noise"), zeroParam, seedNoise)
+		} else {
+			noises := make([]tf.Output, numSeeds)
+			for s := range noises {
+				seedScope := paramScope.SubScope("seed_" + strconv.Itoa(s))
+				noises[s] = op.Mul(seedScope, seedNoise(seedScope, op.Const(seedScope, int64(s))), seedWeights[s])
+			}
+			noiseSum = op.AddN(paramScope, noises)
 		}
-		weightedNoises := op.AddN(paramScope, noises)
-		perturb[i] = op.AssignAddVariableOp(paramScope.SubScope("perturb"), varHandles[i], weightedNoises)
+		weightedNoises := op.Mul(paramScope.SubScope("sigma"), noiseSum, sigmaPH)
+		update := weightedNoises
+		if config.updateRule != nil { // the weighted noises are an estimate of the gradient, which the update rule may do more with.
+			var paramStateUpdates, paramInitState []*tf.Operation
+			update, paramStateUpdates, paramInitState = config.updateRule(paramScope.SubScope("update_rule"), sharedName(ns, pd.Name), zeroParam, weightedNoises, gen)
+			stateUpdates = append(stateUpdates, paramStateUpdates...)
+			initState = append(initState, paramInitState...)
+		}
+		perturb = append(perturb, op.AssignAddVariableOp(paramScope.SubScope("perturb"), varHandles[i], update))
+		deperturb = append(deperturb, op.AssignSubVariableOp(paramScope.SubScope("deperturb"), varHandles[i], update))
+	}
+	noiseProbe := makeNoiseProbe(s.SubScope("noise_probe"), noise, seedScheme, paramDefs, initVals)
+	var ema paramEMA
+	if config.emaParams != nil {
+		var initEMA []*tf.Operation
+		*config.emaParams, ema, initEMA = makeParamEMA(s.SubScope("ema"), ns, config.emaDecay, paramDefs, params, initVals)
+		initParams = append(initParams, initEMA...)
 	}
+	copier := makeVarCopier(s.SubScope("copy"), append(append([]tf.Output{}, varHandles...), ema.handles...), append(append([]tf.Output{}, params...), ema.values...))
 	// Once the user finalizes the scope and gives us session we can run the initialization OPs and construct the state SeedSM struct.
 	makeSeedSM = func(sess *tf.Session) (sm WeightedSeedSM, err error) {
-		_, err = sess.Run(nil, nil, append(initParams, initGeneration))
+		initOps := append(append(initParams, initGeneration, initSigma), initState...)
+		_, err = sess.Run(nil, nil, initOps)
+		if err != nil {
+			return
+		}
 		sm = WeightedSeedSM{
+			Sigma:            config.sigma,
 			sess:             sess,
-			perturb:          perturb,
+			perturb:          append(perturb, stateUpdates...),
 			deperturb:        deperturb,
+			replayRewind:     len(stateUpdates) > 0,
+			chunks:           chunks,
+			copier:           copier,
 			weightsPH:        weights,
 			genPH:            gen,
 			updateGeneration: updateGeneration,
+			sigmaPH:          sigmaPH,
+			updateSigma:      updateSigma,
+			schedule:         config.schedule,
+			seedScheme:       seedScheme,
+			initOps:          initOps,
+			params:           params,
+			ema:              ema,
+			noiseProbe:       noiseProbe,
+			numSeeds:         numSeeds,
+		}
+		if sm.schedule != nil {
+			err = sm.SetSigma(sm.schedule(1))
 		}
 		return
 	}
 	// If the user also wants to calculate the weights, they can run this func.
-	newSeedWeights = func(lossFunc LossFunc, seedWeight tf.Output) (makeSeedWeights func(*tf.Session) (func() ([]float32, error), error)) {
+	newSeedWeights = func(lossFunc LossFunc, seedWeight tf.Output, options ...SeedWeightsOption) (makeSeedWeights func(*tf.Session) (func() ([]float32, error), error)) {
+		config := seedWeightsConfig{shaping: RawFitness}
+		for _, option := range options {
+			option(&config)
+		}
 		seedWeightsScope := s.SubScope("seed_weights")
-		paramCount := len(params) // number of params
-		seedLosses := make([]tf.Output, numSeeds)
-		one := op.Const(seedWeightsScope.SubScope("one"), int64(1))        // needed later
-		curLoss := lossFunc(seedWeightsScope.SubScope("cur_loss"), params) // the loss if the params are unperturbed.
-		seedDeltas := make([]tf.Output, numSeeds)                          // how much did each seed change the loss?
-		// for each seed,
-		for s := range seedDeltas {
-			seedScope := seedWeightsScope.SubScope("child" + strconv.Itoa(s))
-			seed := op.Const(seedScope.SubScope("seed"), int64(s))
-			perturbedParams := make([]tf.Output, paramCount)
-			// perturb all the params
-			for i, param := range params {
-				paramScope := seedScope.SubScope("param_" + strconv.Itoa(i))
-				paramShape := op.Shape(paramScope.SubScope("input"), param, op.ShapeOutType(tf.Int32))
-				paramIndex := op.Const(paramScope.SubScope("param_index"), int64(i))
-				paramSeed := op.Add(paramScope.SubScope("inc_seed"), seed, paramIndex)
-				seedNoise := noise(paramScope.SubScope("perturb_noise"),
-					paramShape,
-					paramSeed,
-					op.Add(paramScope.SubScope("inc_gen"), generation, one), // this is a hack to get the generation to be correct.
-				)
-				perturbedParam := op.Add(paramScope, params[i], seedNoise)
-				perturbedParams[i] = perturbedParam
+		one := op.Const(seedWeightsScope.SubScope("one"), int64(1)) // needed later
+		nextGen := op.Add(seedWeightsScope.SubScope("inc_gen"), generation, one)
+		var curLoss tf.Output
+		if !config.mirrored {
+			curLoss = lossFunc(seedWeightsScope.SubScope("cur_loss"), params) // the loss if the params are unperturbed.
+		}
+		half := op.Const(seedWeightsScope.SubScope("half"), float32(0.5))
+		// seedFitness makes how much one seed changes the loss.
+		seedFitness := func(seedScope *op.Scope, seed tf.Output) tf.Output {
+			// perturb all the params, and if mirrored, also perturb them the other way.
+			perturbedParams, mirroredParams := perturbParams(seedScope, noise, seedScheme, paramDefs, params, seed, nextGen, sigma, config.mirrored)
+			loss := lossFunc(seedScope.SubScope("model"), perturbedParams)
+			if !config.mirrored {
+				return op.Sub(seedScope, curLoss, loss)
 			}
-			seedLosses[s] = lossFunc(seedScope.SubScope("model"), perturbedParams)
+			// compare the two losses instead of comparing to the current loss.
+			mirroredLoss := lossFunc(seedScope.SubScope("mirrored_model"), mirroredParams)
+			return op.Mul(seedScope, op.Sub(seedScope, mirroredLoss, loss), half)
+		}
+		fitnessGraph := FitnessGraph{numSeeds: numSeeds, chunkSize: chunkSize, params: params, generation: generation, sigma: sigma}
+		if chunkSize > 0 { // evaluate the seeds a chunk at a time through one copy of the model, and feed their fitness back in.
+			chunkScope := seedWeightsScope.SubScope("chunk")
+			indices, seeds := makeSeedIndices(chunkScope, chunkSize)
+			chunkDeltas := make([]tf.Output, chunkSize)
+			for i, seed := range seeds {
+				chunkDeltas[i] = seedFitness(chunkScope.SubScope("child"+strconv.Itoa(i)), seed)
+			}
+			fitnessGraph.SeedIndices = indices
+			fitnessGraph.ChunkFitness = op.Pack(chunkScope.SubScope("pack"), chunkDeltas)
+			fitnessGraph.Fitness = op.Placeholder(seedWeightsScope.SubScope("fitness"), tf.Float, op.PlaceholderShape(tf.MakeShape(int64(numSeeds))))
+		} else {
+			seedDeltas := make([]tf.Output, numSeeds) // how much did each seed change the loss?
+			// for each seed,
+			for s := range seedDeltas {
+				seedScope := seedWeightsScope.SubScope("child" + strconv.Itoa(s))
+				seed := op.Const(seedScope.SubScope("seed"), int64(s))
+				seedDeltas[s] = seedFitness(seedScope, seed)
+			}
+			fitnessGraph.SeedFitness = seedDeltas
+			fitnessGraph.Fitness = op.Pack(seedWeightsScope.SubScope("pack"), seedDeltas)
+		}
+		shaped := config.shaping(seedWeightsScope.SubScope("shaping"), fitnessGraph.Fitness, numSeeds)
+		weights := op.Mul(s, shaped, seedWeight)
+		fitnessGraph.Weights = weights
+		if config.graph != nil {
+			*config.graph = fitnessGraph
 		}
-		losses := op.Pack(seedWeightsScope.SubScope("pack"), seedLosses)
-		weights := op.Mul(s, op.Sub(s, curLoss, losses), seedWeight)
 		// once the user has given us the session, we can make the bestSeed func.
 		makeSeedWeights = func(sess *tf.Session) (seedWeights func() ([]float32, error), err error) {
+			if chunkSize > 0 {
+				evaluate, weigh := MakeFitnessFuncs(sess, fitnessGraph)
+				seedWeights = func() (weightsVals []float32, err error) {
+					fitness, err := evaluate(seedRange(numSeeds))
+					if err != nil {
+						return
+					}
+					return weigh(fitness)
+				}
+				return
+			}
 			// Nothing needs to be finalized this time.
 			seedWeights = func() (weightsVals []float32, err error) { // each time the user calls bestWeights(),
 				results, err := sess.Run(nil, []tf.Output{weights}, nil) // pull on lowestSeed,
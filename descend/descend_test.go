@@ -284,6 +284,103 @@ func TestNewWeightedSeedSM(t *testing.T) {
 	}
 }
 
+func TestWeightedSeedSMRewind(t *testing.T) {
+	paramDefs := []ParamDef{
+		ParamDef{Name: "foo", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+		ParamDef{Name: "bar", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+	}
+	// make the first state machine
+	s1 := op.NewScope()
+	noise := MakeNoise(0.003)
+	makeSM1, _, generation1, smParams1 := NewWeightedSeedSM(s1.SubScope("sm"), noise, paramDefs, 2)
+	graph1, err := s1.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess1, err := tf.NewSession(graph1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm1, err := makeSM1(sess1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make the second state machine
+	s2 := op.NewScope()
+	makeSM2, _, _, smParams2 := NewWeightedSeedSM(s2.SubScope("sm"), noise, paramDefs, 2)
+	graph2, err := s2.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess2, err := tf.NewSession(graph2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2, err := makeSM2(sess2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Step([]float32{0.2, 0.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Step([]float32{0.2, 0.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Step([]float32{0.6, 0.4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sm1 takes a different step, and then undoes it.
+	err = sm1.Step([]float32{-3, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sess1.Run(nil, []tf.Output{generation1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Value().(int64) != 1 || sm1.Generation != 1 || len(sm1.SeedWeights) != 1 {
+		t.Fatal("generation was not rewound", results[0].Value(), sm1.Generation, sm1.SeedWeights)
+	}
+	err = sm1.Step([]float32{0.6, 0.4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params1, err := sess1.Run(nil, smParams1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params2, err := sess2.Run(nil, smParams2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := params1[0].Value().([][]float32)[0][0] - params2[0].Value().([][]float32)[0][0]
+	if diff > 1e-6 || diff < -1e-6 {
+		fmt.Println(sm1.SeedWeights, sm2.SeedWeights, sm1.Generation, sm2.Generation)
+		fmt.Println(params1[0].Value().([][]float32)[0][0], params2[0].Value().([][]float32)[0][0])
+		t.Fatal("params are different")
+	}
+	err = sm1.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Rewind()
+	if err != ErrNothingToRewind {
+		t.Fatal("expected ErrNothingToRewind, got", err)
+	}
+}
+
 func TestWeightedSeedSMtrain(t *testing.T) {
 	s := op.NewScope()
 
@@ -345,3 +442,128 @@ func TestWeightedSeedSMtrain(t *testing.T) {
 		t.Fatal("bias is not ~1")
 	}
 }
+
+func TestWeightedSeedSMMirroredtrain(t *testing.T) {
+	sm, ts := newTestWeightedSeedSM(t, withEvalOptions(Mirrored()))
+	for i := 0; i < 1000; i++ { // for 1000 generations,
+		weights, err := ts.seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFitted(t, readParams(t, ts.sess, ts.params))
+}
+
+// stepWithParamDefs steps a SeedSM and a WeightedSeedSM made from paramDefs, and returns their params.
+func stepWithParamDefs(t *testing.T, paramDefs []ParamDef) (seedParams, weightedParams []interface{}) {
+	noise := MakeNoise(0.003)
+	s1 := op.NewScope()
+	makeSeedSM, _, _, params1 := NewSeedSM(s1.SubScope("sm"), noise, paramDefs, 3)
+	graph1, err := s1.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess1, err := tf.NewSession(graph1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedSM, err := makeSeedSM(sess1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := op.NewScope()
+	makeWeightedSM, _, _, params2 := NewWeightedSeedSM(s2.SubScope("sm"), noise, paramDefs, 3)
+	graph2, err := s2.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess2, err := tf.NewSession(graph2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weightedSM, err := makeWeightedSM(sess2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seed := range []int64{3, 1, 4} {
+		err = seedSM.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = weightedSM.Step([]float32{0.2, -0.5, float32(seed)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return readParams(t, sess1, params1), readParams(t, sess2, params2)
+}
+
+func TestParamDefNoiseScale(t *testing.T) {
+	paramDefs := []ParamDef{
+		ParamDef{Name: "foo", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+		ParamDef{Name: "bar", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+	}
+	seedParams, weightedParams := stepWithParamDefs(t, paramDefs)
+	paramDefs[1].NoiseScale = 10
+	scaledSeedParams, scaledWeightedParams := stepWithParamDefs(t, paramDefs)
+	if seedParams[0].([][]float32)[0][0] != scaledSeedParams[0].([][]float32)[0][0] {
+		t.Fatal("scaling bar changed foo")
+	}
+	for _, pair := range [][2]float32{
+		{seedParams[1].(float32), scaledSeedParams[1].(float32)},
+		{weightedParams[1].(float32), scaledWeightedParams[1].(float32)},
+	} {
+		diff := pair[0]*10 - pair[1]
+		if pair[0] == 0 || diff > 1e-6 || diff < -1e-6 {
+			t.Fatal("bar was not scaled by 10", pair)
+		}
+	}
+}
+
+func TestParamDefFrozen(t *testing.T) {
+	paramDefs := []ParamDef{
+		ParamDef{Name: "foo", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+		ParamDef{Name: "bar", Init: tfutils.Zero(tf.Float, tf.ScalarShape()), Frozen: true},
+	}
+	seedParams, weightedParams := stepWithParamDefs(t, paramDefs)
+	if seedParams[1].(float32) != 0 || weightedParams[1].(float32) != 0 {
+		t.Fatal("bar is frozen, but changed", seedParams[1], weightedParams[1])
+	}
+	if seedParams[0].([][]float32)[0][0] == 0 || weightedParams[0].([][]float32)[0][0] == 0 {
+		t.Fatal("foo is not frozen, but did not change")
+	}
+
+	// if the loss only depends on the frozen param, the seeds can not change it.
+	s := op.NewScope()
+	lossFunc := func(s *op.Scope, params []tf.Output) tf.Output {
+		return op.Square(s, op.Sub(s, params[1], op.Const(s.SubScope("target"), float32(3))))
+	}
+	makeSM, newSeedWeights, _, _ := NewWeightedSeedSM(s.SubScope("sm"), MakeNoise(0.003), paramDefs, 3)
+	fitnessGraph := FitnessGraph{}
+	newSeedWeights(lossFunc, op.Const(s.SubScope("seed_weight"), float32(1)), ExportFitnessGraph(&fitnessGraph))
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = makeSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sess.Run(nil, fitnessGraph.SeedFitness, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Value().(float32) != 0 {
+			t.Fatal("perturbing the seeds changed the loss of a frozen param")
+		}
+	}
+}
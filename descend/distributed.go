@@ -0,0 +1,287 @@
+package descend
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Distributed ES with a WeightedSeedSM.
+// The coordinator and every worker build the same graph.
+// Each generation, the coordinator sends each worker the weights of the last step, and a share of the seeds.
+// The worker applies the step, evaluates its seeds, and sends back the fitness of each.
+// The coordinator then calculates the weights from the fitness of all the seeds, and steps.
+// Only weights and fitness ever cross the network, never params.
+
+// hello is sent to each worker when it connects.
+type hello struct {
+	Checkpoint []byte // the lineage of the coordinator, for the worker to load.
+}
+
+// task is sent to each worker every generation.
+type task struct {
+	Generation int64     // the generation which the worker should be at once it has applied Step.
+	Step       []float32 // the weights of the last step, if the worker has not yet applied it.
+	StepSigma  float32   // the sigma which the last step used.
+	Sigma      float32   // the sigma with which to evaluate the seeds.
+	Seeds      []int     // the indices of the seeds to evaluate.
+	Done       bool      // the worker should stop once it has applied Step.
+}
+
+// result is sent back by the worker.
+type result struct {
+	Fitness []float32 // the fitness of each of the seeds of the task.
+	Err     string
+}
+
+// MakeFitnessFuncs makes funcs to evaluate the fitness of some of the seeds, and to calculate the weights of the seeds from the fitness of all of them.
+// graph must have been filled in by newSeedWeights using ExportFitnessGraph.
+func MakeFitnessFuncs(sess *tf.Session, graph FitnessGraph) (
+	evaluate func(seeds []int) ([]float32, error),
+	weigh func(fitness []float32) ([]float32, error),
+) {
+	evaluate = func(seeds []int) ([]float32, error) {
+		return evaluateSeeds(sess, graph, nil, seeds)
+	}
+	weigh = func(fitness []float32) (weights []float32, err error) {
+		fitnessTensor, err := tf.NewTensor(fitness)
+		if err != nil {
+			return
+		}
+		// feeding the fitness means that TF does not need to evaluate any of the seeds.
+		results, err := sess.Run(map[tf.Output]*tf.Tensor{graph.Fitness: fitnessTensor}, []tf.Output{graph.Weights}, nil)
+		if err != nil {
+			return
+		}
+		weights = results[0].Value().([]float32)
+		return
+	}
+	return
+}
+
+// evaluateSeeds evaluates the fitness of the seeds in sess, with feeds.
+func evaluateSeeds(sess *tf.Session, graph FitnessGraph, feeds map[tf.Output]*tf.Tensor, seeds []int) (fitness []float32, err error) {
+	if graph.chunkSize > 0 {
+		for _, seed := range seeds {
+			if seed < 0 || seed >= graph.numSeeds {
+				err = fmt.Errorf("descend: seed %d is out of range for %d seeds", seed, graph.numSeeds)
+				return
+			}
+		}
+		return evalChunks(sess, feeds, graph.SeedIndices, graph.ChunkFitness, graph.chunkSize, seeds)
+	}
+	fetches := make([]tf.Output, len(seeds))
+	for i, seed := range seeds {
+		if seed < 0 || seed >= len(graph.SeedFitness) {
+			err = fmt.Errorf("descend: seed %d is out of range for %d seeds", seed, len(graph.SeedFitness))
+			return
+		}
+		fetches[i] = graph.SeedFitness[seed]
+	}
+	results, err := sess.Run(feeds, fetches, nil) // the unperturbed loss is shared, so it is only calculated once.
+	if err != nil {
+		return
+	}
+	fitness = make([]float32, len(seeds))
+	for i, result := range results {
+		fitness[i] = result.Value().(float32)
+	}
+	return
+}
+
+// workerConn is the coordinator's end of the connection to a worker.
+type workerConn struct {
+	conn       net.Conn
+	enc        *gob.Encoder
+	dec        *gob.Decoder
+	generation int64 // the generation which the worker is at.
+}
+
+// Coordinator hands out seeds to workers and steps its WeightedSeedSM by the weights calculated from their fitness.
+// The state machine must not be stepped or rewound except through the coordinator.
+type Coordinator struct {
+	sm       *WeightedSeedSM
+	weigh    func([]float32) ([]float32, error)
+	listener net.Listener
+	workers  []*workerConn
+}
+
+// NewCoordinator makes a coordinator which accepts workers on listener.
+// weigh is usually made by MakeFitnessFuncs.
+func NewCoordinator(sm *WeightedSeedSM, weigh func([]float32) ([]float32, error), listener net.Listener) *Coordinator {
+	return &Coordinator{
+		sm:       sm,
+		weigh:    weigh,
+		listener: listener,
+	}
+}
+
+// Accept waits for n more workers to connect, and sends each of them the lineage so far.
+func (c *Coordinator) Accept(n int) (err error) {
+	for i := 0; i < n; i++ {
+		var conn net.Conn
+		conn, err = c.listener.Accept()
+		if err != nil {
+			return
+		}
+		buf := &bytes.Buffer{}
+		err = c.sm.Save(buf)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		worker := &workerConn{
+			conn:       conn,
+			enc:        gob.NewEncoder(conn),
+			dec:        gob.NewDecoder(conn),
+			generation: c.sm.Generation,
+		}
+		err = worker.enc.Encode(hello{Checkpoint: buf.Bytes()})
+		if err != nil {
+			conn.Close()
+			return
+		}
+		c.workers = append(c.workers, worker)
+	}
+	return
+}
+
+// Workers returns the number of workers which are connected.
+func (c *Coordinator) Workers() int {
+	return len(c.workers)
+}
+
+// makeTask makes a task to bring the worker up to the generation of the coordinator.
+func (c *Coordinator) makeTask(worker *workerConn) (t task) {
+	t = task{Generation: c.sm.Generation, Sigma: c.sm.Sigma}
+	if worker.generation < c.sm.Generation {
+		last := len(c.sm.SeedWeights) - 1
+		t.Step = c.sm.SeedWeights[last]
+		t.StepSigma = c.sm.Sigmas[last]
+	}
+	return
+}
+
+// Step has the workers evaluate the seeds, and steps by the weights calculated from their fitness.
+func (c *Coordinator) Step() (err error) {
+	if len(c.workers) == 0 {
+		return errors.New("descend: coordinator has no workers")
+	}
+	shares := make([][]int, len(c.workers))
+	for i := 0; i < c.sm.numSeeds; i++ {
+		shares[i%len(c.workers)] = append(shares[i%len(c.workers)], i)
+	}
+	for w, worker := range c.workers {
+		t := c.makeTask(worker)
+		t.Seeds = shares[w]
+		err = worker.enc.Encode(t)
+		if err != nil {
+			return
+		}
+		worker.generation = c.sm.Generation
+	}
+	fitness := make([]float32, c.sm.numSeeds)
+	for w, worker := range c.workers {
+		r := result{}
+		err = worker.dec.Decode(&r)
+		if err != nil {
+			return
+		}
+		if r.Err != "" {
+			return fmt.Errorf("descend: worker %d: %s", w, r.Err)
+		}
+		if len(r.Fitness) != len(shares[w]) {
+			return fmt.Errorf("descend: worker %d sent %d fitness values for %d seeds", w, len(r.Fitness), len(shares[w]))
+		}
+		for i, seed := range shares[w] {
+			fitness[seed] = r.Fitness[i]
+		}
+	}
+	weights, err := c.weigh(fitness)
+	if err != nil {
+		return
+	}
+	err = c.sm.Step(weights)
+	return
+}
+
+// Close sends the last step to the workers, tells them to stop, and closes the listener.
+func (c *Coordinator) Close() (err error) {
+	for _, worker := range c.workers {
+		t := c.makeTask(worker)
+		t.Done = true
+		encodeErr := worker.enc.Encode(t)
+		if encodeErr != nil && err == nil {
+			err = encodeErr
+		}
+		worker.conn.Close()
+	}
+	c.workers = nil
+	closeErr := c.listener.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// RunWorker connects to the coordinator at addr, and evaluates the seeds which it is given until the coordinator closes.
+// sm must have been made from the same noise func, param defs and number of seeds as the coordinator's, and evaluate is usually made by MakeFitnessFuncs.
+func RunWorker(addr string, sm *WeightedSeedSM, evaluate func([]int) ([]float32, error)) (err error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+	h := hello{}
+	err = dec.Decode(&h)
+	if err != nil {
+		return
+	}
+	err = sm.Load(bytes.NewReader(h.Checkpoint))
+	if err != nil {
+		return
+	}
+	for {
+		t := task{}
+		err = dec.Decode(&t)
+		if err != nil {
+			return
+		}
+		if t.Step != nil {
+			err = sm.step(t.Step, t.StepSigma)
+			if err != nil {
+				return
+			}
+		}
+		if sm.Generation != t.Generation {
+			return fmt.Errorf("descend: worker is at generation %d but coordinator is at %d", sm.Generation, t.Generation)
+		}
+		if t.Done {
+			return
+		}
+		if sm.Sigma != t.Sigma {
+			err = sm.SetSigma(t.Sigma)
+			if err != nil {
+				return
+			}
+		}
+		fitness, evalErr := evaluate(t.Seeds)
+		r := result{Fitness: fitness}
+		if evalErr != nil {
+			r.Err = evalErr.Error()
+		}
+		err = enc.Encode(r)
+		if err != nil {
+			return
+		}
+		if evalErr != nil {
+			return evalErr
+		}
+	}
+}
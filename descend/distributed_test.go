@@ -0,0 +1,119 @@
+package descend
+
+import (
+	"net"
+	"testing"
+)
+
+type distributedNode struct {
+	sm WeightedSeedSM
+	testSM
+	evaluate func([]int) ([]float32, error)
+	weigh    func([]float32) ([]float32, error)
+}
+
+// makeDistributedNode builds the same graph for the coordinator, each worker, and the local run to compare against.
+func makeDistributedNode(t *testing.T) (node distributedNode) {
+	node.sm, node.testSM = newTestWeightedSeedSM(t)
+	node.evaluate, node.weigh = MakeFitnessFuncs(node.sess, node.fitness)
+	return
+}
+
+func TestMakeFitnessFuncs(t *testing.T) {
+	node := makeDistributedNode(t)
+	weights, err := node.seedWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// evaluate the seeds in two parts, as two workers would.
+	evens, err := node.evaluate([]int{0, 2, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	odds, err := node.evaluate([]int{1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitness := []float32{evens[0], odds[0], evens[1], odds[1], evens[2]}
+	weighed, err := node.weigh(fitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range weights {
+		if weighed[i] != weights[i] {
+			t.Fatal("weights are different", weights, weighed)
+		}
+	}
+	_, err = node.evaluate([]int{5})
+	if err == nil {
+		t.Fatal("expected an error for an out of range seed")
+	}
+}
+
+func TestDistributedtrain(t *testing.T) {
+	local := makeDistributedNode(t)
+	coordinator := makeDistributedNode(t)
+	workers := []distributedNode{makeDistributedNode(t), makeDistributedNode(t)}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCoordinator(&coordinator.sm, coordinator.weigh, listener)
+	workerErrs := make(chan error, len(workers))
+	startWorker := func(worker *distributedNode) {
+		go func() {
+			workerErrs <- RunWorker(listener.Addr().String(), &worker.sm, worker.evaluate)
+		}()
+	}
+	startWorker(&workers[0])
+	err = c.Accept(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		if i == 100 { // the second worker joins late, and must catch up.
+			startWorker(&workers[1])
+			err = c.Accept(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		weights, err := local.seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = local.sm.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range workers {
+		err = <-workerErrs
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := readParams(t, local.sess, local.params)
+	nodes := append([]distributedNode{coordinator}, workers...)
+	for n, node := range nodes {
+		if node.sm.Generation != local.sm.Generation {
+			t.Fatal("node", n, "is at generation", node.sm.Generation, "not", local.sm.Generation)
+		}
+		actual := readParams(t, node.sess, node.params)
+		for i := range expected {
+			diff := actual[i].(float32) - expected[i].(float32)
+			if diff > 1e-4 || diff < -1e-4 {
+				t.Fatal("node", n, "has params", actual, "not", expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package descend
+
+import (
+	"fmt"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// WithParamEMA makes the state machine keep an exponential moving average of each param, and fills in averaged with outputs to read them, in the same order as the params.
+// Each step moves the averages towards the new params by 1-decay, so they jitter far less than the params, and are better for measuring accuracy or exporting.
+// decay must be between 0 and 1.
+// The averages start at the initial params. Rewind restores the averages from before the last step, and Load and replays rebuild them by stepping, so they are always those of the lineage.
+// Frozen params are not averaged; their outputs are the params themselves.
+func WithParamEMA(decay float32, averaged *[]tf.Output) SMOption {
+	return func(c *smConfig) {
+		c.emaDecay = decay
+		c.emaParams = averaged
+	}
+}
+
+// paramEMA holds the ops of the moving averages of the params of a state machine.
+// Each average has a second variable which holds its value before the last step, so that one step can be undone exactly.
+type paramEMA struct {
+	save     []*tf.Operation // copies the averages to the previous averages. Run it with the step.
+	update   []*tf.Operation // moves the averages towards the params. Must be run after the params are stepped.
+	undo     []*tf.Operation // sets the averages to the previous averages.
+	undoable bool            // the previous averages are those from before the last step.
+	handles  []tf.Output     // the variables of the averages, so that they can be copied.
+	values   []tf.Output     // the values of handles.
+}
+
+// makeParamEMA makes a shadow variable for each param which is not frozen, initialized along with it from init, the output of its Init.
+// It returns the ops to initialize the shadow variables, which must be run in the same run as the ops which initialize the params, so that random inits match.
+func makeParamEMA(s *op.Scope, ns string, decay float32, paramDefs []ParamDef, params, inits []tf.Output) (averaged []tf.Output, ema paramEMA, initOps []*tf.Operation) {
+	if !(decay > 0 && decay < 1) {
+		s.UpdateErr("WithParamEMA", fmt.Errorf("descend: the decay of the moving averages must be between 0 and 1, not %v", decay))
+		return
+	}
+	averaged = make([]tf.Output, len(params))
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			averaged[i] = params[i]
+			continue
+		}
+		emaScope := s.SubScope(pd.Name)
+		handle := op.VarHandleOp(emaScope, inits[i].DataType(), inits[i].Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name+"/ema")))
+		previousScope := emaScope.SubScope("previous")
+		previousHandle := op.VarHandleOp(previousScope, inits[i].DataType(), inits[i].Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name+"/ema_previous")))
+		initOps = append(initOps, op.AssignVariableOp(emaScope.SubScope("init"), handle, inits[i]))
+		averaged[i] = op.ReadVariableOp(emaScope, handle, inits[i].DataType())
+		ema.handles = append(ema.handles, handle)
+		ema.values = append(ema.values, averaged[i])
+		previous := op.ReadVariableOp(previousScope, previousHandle, inits[i].DataType())
+		ema.save = append(ema.save, op.AssignVariableOp(previousScope.SubScope("save"), previousHandle, averaged[i]))
+		ema.undo = append(ema.undo, op.AssignVariableOp(emaScope.SubScope("undo"), handle, previous))
+		// average -= (1-decay)*(average-param), which is decay*average + (1-decay)*param.
+		updateScope := emaScope.SubScope("update")
+		rate := op.Const(updateScope.SubScope("rate"), 1-decay)
+		ema.update = append(ema.update, op.AssignSubVariableOp(updateScope, handle, op.Mul(updateScope, rate, op.Sub(updateScope, averaged[i], params[i]))))
+	}
+	return
+}
+
+// stepped updates the averages after the params have been stepped, with save run along with the step.
+func (ema *paramEMA) stepped(sess *tf.Session) (err error) {
+	if len(ema.update) == 0 {
+		return
+	}
+	_, err = sess.Run(nil, nil, ema.update)
+	if err != nil {
+		return
+	}
+	ema.undoable = true
+	return
+}
+
+// needsReplay returns true if the averages can not undo the last step, because it was already undone.
+func (ema *paramEMA) needsReplay() bool {
+	return len(ema.undo) > 0 && !ema.undoable
+}
+
+// rewind restores the averages from before the last step.
+func (ema *paramEMA) rewind(sess *tf.Session) (err error) {
+	if len(ema.undo) == 0 {
+		return
+	}
+	_, err = sess.Run(nil, nil, ema.undo)
+	if err != nil {
+		return
+	}
+	ema.undoable = false
+	return
+}
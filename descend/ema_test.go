@@ -0,0 +1,135 @@
+package descend
+
+import (
+	"bytes"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestSeedSMParamEMA(t *testing.T) {
+	var averaged []tf.Output
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withSMOptions(WithParamEMA(0.75, &averaged)))
+	if len(averaged) != len(ts.params) {
+		t.Fatal("expected an average for each param, got", len(averaged))
+	}
+	expected := []float32{0, 0}
+	if actual := readParams(t, ts.sess, averaged); !paramsClose(expected, actual) {
+		t.Fatal("expected", expected, "got", actual)
+	}
+	history := [][]float32{}
+	for _, seed := range []int64{3, 1, 4, 1, 5} {
+		err := sm.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, expected)
+		values := readParams(t, ts.sess, ts.params)
+		next := make([]float32, len(values))
+		for i, value := range values {
+			next[i] = 0.75*expected[i] + 0.25*value.(float32)
+		}
+		expected = next
+		if actual := readParams(t, ts.sess, averaged); !paramsClose(expected, actual) {
+			t.Fatal("expected", expected, "got", actual)
+		}
+	}
+	for i := len(history) - 1; i >= 3; i-- {
+		err := sm.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := readParams(t, ts.sess, averaged); !paramsClose(history[i], actual) {
+			t.Fatal("expected", history[i], "got", actual)
+		}
+	}
+	// a checkpoint replays the lineage, so the averages are rebuilt.
+	buf := bytes.Buffer{}
+	err := sm.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var averaged2 []tf.Output
+	sm2, ts2 := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withSMOptions(WithParamEMA(0.75, &averaged2)))
+	err = sm2.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !paramsClose(readParams(t, ts.sess, averaged), readParams(t, ts2.sess, averaged2)) {
+		t.Fatal("averages were not rebuilt by the replay")
+	}
+}
+
+func TestWeightedSeedSMParamEMA(t *testing.T) {
+	s := op.NewScope()
+	_, paramDefs := makeOptimizerLoss(s)
+	paramDefs[1].Frozen = true
+	var averaged []tf.Output
+	sm, ts := newTestWeightedSeedSM(t, withParamDefs(paramDefs), withNoise(MakeNoise(0.1)), withNumSeeds(2), withSMOptions(WithUpdateRule(Adam(0.1, 0.9, 0.999, 1e-8)), WithParamEMA(0.5, &averaged)))
+	if averaged[1] != ts.params[1] {
+		t.Fatal("a frozen param should be its own average")
+	}
+	err := sm.Step([]float32{0.2, 0.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readParams(t, ts.sess, averaged)
+	expected := 0.5*before[0].(float32) + 0.5*readParams(t, ts.sess, ts.params)[0].(float32)
+	err = sm.Step([]float32{-0.5, 0.3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := readParams(t, ts.sess, averaged[:1]); !paramsClose([]float32{expected}, actual) {
+		t.Fatal("expected", expected, "got", actual)
+	}
+	// Adam has state, so the rewind replays, which must rebuild the averages too.
+	err = sm.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := readParams(t, ts.sess, averaged); !paramsClose(before, actual) {
+		t.Fatal("expected", before, "got", actual)
+	}
+}
+
+func TestParamEMARewindIsExact(t *testing.T) {
+	var averaged []tf.Output
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withSMOptions(WithParamEMA(0.1, &averaged)))
+	for _, seed := range []int64{3, 1, 4} {
+		err := sm.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := readParams(t, ts.sess, averaged)
+	for i := 0; i < 10; i++ { // as a local search rejecting proposals does.
+		err := sm.Step(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := readParams(t, ts.sess, averaged)
+		for j := range before {
+			if after[j] != before[j] {
+				t.Fatal("averages changed after step and rewind", before, after)
+			}
+		}
+	}
+}
+
+func TestParamEMADecay(t *testing.T) {
+	for _, decay := range []float32{0, 1, -0.5} {
+		s := op.NewScope()
+		_, paramDefs := makeOptimizerLoss(s)
+		var averaged []tf.Output
+		NewSeedSM(s.SubScope("sm"), MakeNoise(0.1), paramDefs, 5, WithParamEMA(decay, &averaged))
+		_, err := s.Finalize()
+		if err == nil {
+			t.Fatal("expected an error for a decay of", decay)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/is8ac/tfutils/descend"
+	"github.com/is8ac/tfutils/descend/rl"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func main() {
+	const numSeeds = 50
+	const episodes = 5
+	const maxSteps = 500
+	const noiseStdev float32 = 0.1
+	const seedScale float32 = 1
+	s := op.NewScope()
+	makeEnv := func() rl.Environment { return &rl.CartPole{} }
+	env := makeEnv()
+	paramDefs, policy := rl.MLPPolicy(env.ObservationSize(), 16, env.ActionSize()) // a small net which maps observations to actions.
+	lossFunc, goLoss := descend.NewGoLoss()                                        // the loss is computed in Go by running episodes.
+	makeSM, newSeedWeights, _, params := descend.NewWeightedSeedSM(s.SubScope("sm"), descend.MakeNoise(noiseStdev), paramDefs, numSeeds)
+	fitnessGraph := descend.FitnessGraph{}
+	newSeedWeights(lossFunc, op.Const(s.SubScope("seed_scale"), seedScale),
+		descend.ExportFitnessGraph(&fitnessGraph),         // the GoLoss needs the graph to feed the losses to.
+		descend.WithFitnessShaping(descend.CenteredRanks), // returns vary a lot, so use ranks.
+	)
+	graph, err := s.Finalize()
+	if err != nil {
+		panic(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		panic(err)
+	}
+	sm, err := makeSM(sess)
+	if err != nil {
+		panic(err)
+	}
+	rolloutLoss := rl.MakeRolloutLoss(makeEnv, policy, episodes, maxSteps, 42)
+	trainer := descend.Trainer{
+		Optimizer:    descend.NewWeightedSeedOptimizer(&sm, goLoss.MakeSeedWeights(sess, fitnessGraph, rolloutLoss)),
+		Generations:  100,
+		EvalInterval: 5,
+		Eval: func() (episodeReturn float32, err error) {
+			tensors, err := sess.Run(nil, params, nil)
+			if err != nil {
+				return
+			}
+			loss, err := rolloutLoss(tensors)
+			return -loss, err
+		},
+		Maximize: true,
+		OnEval: func(generation int64, episodeReturn float32, best bool) error {
+			fmt.Println(generation, episodeReturn)
+			return nil
+		},
+	}
+	result, err := trainer.Train()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("best return:", result.BestMetric, "at generation", result.BestGeneration)
+	// The return should climb towards 500, the most which an episode can give.
+}
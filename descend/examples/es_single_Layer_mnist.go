@@ -93,28 +93,23 @@ func main() {
 		panic(err)
 	}
 	accuracy := finalizeAccuracy(sess) // finally make the accuracy func.
-	for i := 0; i < 2000; i++ {        // for 1000 generations,
-		seed, err := bestSeed()
-		if err != nil {
-			panic(err)
-		}
-		//fmt.Println(seed)
-		err = sm.Step(seed)
-		if err != nil {
-			panic(err)
-		}
-		if i%10 == 0 {
-			acc, err := accuracy()
-			if err != nil {
-				panic(err)
-			}
-			_, err = sess.Run(nil, nil, []*tf.Operation{logAcc, logWeightsHist})
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println(i, acc*100, "%")
-		}
+	trainer := descend.Trainer{
+		Optimizer:    descend.NewSeedOptimizer(&sm, bestSeed),
+		Generations:  2000, // train for 2000 generations,
+		EvalInterval: 10,   // checking the accuracy every 10.
+		Eval:         accuracy,
+		Maximize:     true,
+		OnEval: func(generation int64, acc float32, best bool) error {
+			fmt.Println(generation, acc*100, "%")
+			_, err := sess.Run(nil, nil, []*tf.Operation{logAcc, logWeightsHist})
+			return err
+		},
+	}
+	result, err := trainer.Train()
+	if err != nil {
+		panic(err)
 	}
+	fmt.Println("best accuracy:", result.BestMetric*100, "% at generation", result.BestGeneration)
 	_, err = sess.Run(nil, nil, []*tf.Operation{closeSummaryWriter})
 	if err != nil {
 		panic(err)
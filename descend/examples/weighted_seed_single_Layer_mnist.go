@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/is8ac/tfutils"
@@ -18,6 +19,7 @@ func main() {
 	const batchSize = 400
 	const noiseStdev float32 = 0.003
 	const seedScale float32 = 200
+	const checkpointPath = "weighted_seed_single_layer.ckpt"
 	err := mnist.Download()
 	if err != nil {
 		panic(err)
@@ -52,11 +54,13 @@ func main() {
 	}
 
 	noise := descend.MakeNoise(noiseStdev) // make the func to make noise
+	var averagedParams []tf.Output         // a moving average of the params, which jitters less than they do.
 	learningRate := op.Const(s.SubScope("learning_rate"), float32(seedScale))
-	paramDefs, lossFunc, makeFinalizeAccuracy := models.MakeSingleLayerNN(images, labels)                                 // create the funcs to evaluate loss
-	makeSM, newSeedWeights, generation, params := descend.NewWeightedSeedSM(s.SubScope("sm"), noise, paramDefs, numSeeds) // make the state machine.
-	makeSeedWeights := newSeedWeights(lossFunc, learningRate)                                                             // make the ops to get calculate the best seed.
-	finalizeAccuracy, accuracyOP := makeFinalizeAccuracy(s.SubScope("accuracy"), params, testImages, testLabels)          // give the accuracy func params and some test data.
+	paramDefs, lossFunc, makeFinalizeAccuracy := models.MakeSingleLayerNN(images, labels)                                                                             // create the funcs to evaluate loss
+	makeSM, newSeedWeights, generation, params := descend.NewWeightedSeedSM(s.SubScope("sm"), noise, paramDefs, numSeeds, descend.WithParamEMA(0.9, &averagedParams)) // make the state machine, which also averages the params.
+	makeSeedWeights := newSeedWeights(lossFunc, learningRate)                                                                                                         // make the ops to get calculate the best seed.
+	finalizeAccuracy, accuracyOP := makeFinalizeAccuracy(s.SubScope("accuracy"), params, testImages, testLabels)                                                      // give the accuracy func params and some test data.
+	_, averagedAccuracyOP := makeFinalizeAccuracy(s.SubScope("averaged_accuracy"), averagedParams, testImages, testLabels)                                            // and also the averaged params.
 
 	loggingScope := s.SubScope("logging")
 	writer := op.SummaryWriter(loggingScope, op.SummaryWriterSharedName("tb_logs"))
@@ -71,6 +75,7 @@ func main() {
 		op.Const(loggingScope.SubScope("filename_suffix"), ".tblog"),
 	)
 	logAcc := op.WriteScalarSummary(loggingScope, writer, generation, op.Const(s.SubScope("acc_tag"), "accuracy"), accuracyOP)
+	logAveragedAcc := op.WriteScalarSummary(loggingScope.SubScope("averaged"), writer, generation, op.Const(s.SubScope("averaged_acc_tag"), "averaged_accuracy"), averagedAccuracyOP)
 	logWeightsHist := op.WriteHistogramSummary(loggingScope, writer, generation, op.Const(loggingScope.SubScope("weights_hist_tag"), "weights"), params[0])
 	closeSummaryWriter := op.CloseSummaryWriter(loggingScope, writer)
 	graph, err := s.Finalize()
@@ -85,6 +90,13 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if _, err := os.Stat(checkpointPath); err == nil { // if we crashed last time, resume where we left off.
+		err = sm.LoadFile(checkpointPath)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("resumed at generation", sm.Generation)
+	}
 	seedWeights, err := makeSeedWeights(sess) // Finalize the seed evaluator
 	if err != nil {
 		panic(err)
@@ -98,28 +110,29 @@ func main() {
 		panic(err)
 	}
 	accuracy := finalizeAccuracy(sess) // finally, make the accuracy func.
-	for i := 0; i < 3000; i++ {        // for 1000 generations,
-		weights, err := seedWeights()
-		if err != nil {
-			panic(err)
-		}
-		//fmt.Println(seed)
-		err = sm.Step(weights)
-		if err != nil {
-			panic(err)
-		}
-		if i%10 == 0 {
-			acc, err := accuracy()
-			if err != nil {
-				panic(err)
-			}
-			_, err = sess.Run(nil, nil, []*tf.Operation{logAcc, logWeightsHist})
-			if err != nil {
-				panic(err)
+	trainer := descend.Trainer{
+		Optimizer:    descend.NewWeightedSeedOptimizer(&sm, seedWeights),
+		Generations:  3000, // train for 3000 generations,
+		EvalInterval: 10,   // checking the accuracy every 10.
+		Eval:         accuracy,
+		Maximize:     true,
+		OnGeneration: func(generation int64) error {
+			if generation%100 == 0 {
+				return sm.SaveFile(checkpointPath)
 			}
-			fmt.Println(i, acc*100, "%")
-		}
+			return nil
+		},
+		OnEval: func(generation int64, acc float32, best bool) error {
+			fmt.Println(generation, acc*100, "%")
+			_, err := sess.Run(nil, nil, []*tf.Operation{logAcc, logAveragedAcc, logWeightsHist})
+			return err
+		},
+	}
+	result, err := trainer.Train()
+	if err != nil {
+		panic(err)
 	}
+	fmt.Println("best accuracy:", result.BestMetric*100, "% at generation", result.BestGeneration)
 	_, err = sess.Run(nil, nil, []*tf.Operation{closeSummaryWriter})
 	if err != nil {
 		panic(err)
@@ -0,0 +1,261 @@
+package descend
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Individual is a member of the population of a GA, NoveltySearch or MAPElites.
+// It is encoded as the seeds which, stepped from the initial params, make its params, so it takes a few bytes per generation however big the model is.
+type Individual struct {
+	Seeds    []int64
+	Fitness  float32   // the negative of the loss.
+	Behavior []float32 // with WithBehavior, the behavior of its params.
+}
+
+// breeder makes and evaluates the children of lineages of seeds on a SeedSM.
+// Only one individual is materialized in the param variables at a time, by replaying its seeds, so populations can be far larger than would fit in memory.
+type breeder struct {
+	sm       *SeedSM
+	evaluate func([]int) ([]float32, [][]float32, error)
+	numSeeds int
+	sigma    float32 // the sigma of the first step of every lineage.
+	rng      *rand.Rand
+}
+
+// newBreeder makes a breeder which draws mutations from the seeds of graph, and resets sm to its initial params.
+func newBreeder(sm *SeedSM, graph FitnessGraph, config gaConfig) (b breeder, err error) {
+	b = breeder{
+		sm:       sm,
+		numSeeds: graph.numSeeds,
+		sigma:    sm.Sigma,
+		rng:      config.rng,
+	}
+	if len(config.sessions) > 0 {
+		b.evaluate = makeParallelEvaluate(sm.sess, config.sessions, graph)
+	} else {
+		b.evaluate = func(seeds []int) ([]float32, [][]float32, error) {
+			return evaluateBehaviors(sm.sess, graph, nil, seeds)
+		}
+	}
+	err = sm.replay(nil, nil, b.sigma)
+	return
+}
+
+// GA is a genetic algorithm in the style of Deep-GA.
+// Each generation, the fittest individuals are the parents, and each child is a parent mutated by appending one seed.
+// The GA steps and resets the SeedSM itself; it must not be stepped by anything else.
+type GA struct {
+	Generation int64
+	Population []Individual // sorted with the fittest first.
+	breeder
+	config gaConfig
+}
+
+// GAOption changes how a GA, NoveltySearch or MAPElites selects and mutates.
+type GAOption func(*gaConfig)
+
+type gaConfig struct {
+	truncation  int
+	elites      int
+	rng         *rand.Rand
+	sessions    []*tf.Session
+	neighbors   int
+	archiveRate int
+}
+
+// WithTruncation sets how many of the fittest, or for NoveltySearch the most novel, individuals are the parents of the next generation. The default is a tenth of the population.
+func WithTruncation(n int) GAOption {
+	return func(c *gaConfig) {
+		c.truncation = n
+	}
+}
+
+// WithElites sets how many of the fittest individuals are copied into the next generation unchanged. The default is 1.
+// Their fitness is not evaluated again, so with a noisy loss they may be luckier than they are fit.
+func WithElites(n int) GAOption {
+	return func(c *gaConfig) {
+		c.elites = n
+	}
+}
+
+// WithGARand sets the source of randomness for selection and mutation. The default is seeded with 0, so runs are reproducible.
+func WithGARand(rng *rand.Rand) GAOption {
+	return func(c *gaConfig) {
+		c.rng = rng
+	}
+}
+
+// WithGASessions makes the children of each parent be evaluated split between sessions, as MakeParallelBestSeed does.
+func WithGASessions(sessions []*tf.Session) GAOption {
+	return func(c *gaConfig) {
+		c.sessions = sessions
+	}
+}
+
+// makeGAConfig applies the options to the defaults for a population of popSize.
+func makeGAConfig(popSize int, options []GAOption) (config gaConfig) {
+	config = gaConfig{truncation: popSize / 10, elites: 1, neighbors: 10, archiveRate: 1}
+	for _, option := range options {
+		option(&config)
+	}
+	if config.truncation < 1 {
+		config.truncation = 1
+	}
+	if config.rng == nil {
+		config.rng = rand.New(rand.NewSource(0))
+	}
+	return
+}
+
+// NewGA makes a GA with popSize individuals, each of which is the initial params mutated by one seed.
+// graph must have been filled in by the newBestSeed of sm using ExportFitnessGraph; mutations are drawn from its seeds.
+// Use ChunkedEval to have many seeds to draw from without making the graph bigger.
+// sm is reset to its initial params, and its current sigma is used for the first step of every lineage.
+func NewGA(sm *SeedSM, graph FitnessGraph, popSize int, options ...GAOption) (ga GA, err error) {
+	config := makeGAConfig(popSize, options)
+	if popSize < 1 || config.elites >= popSize {
+		err = errors.New("descend: the population must be bigger than the number of elites")
+		return
+	}
+	ga = GA{config: config}
+	ga.breeder, err = newBreeder(sm, graph, config)
+	if err != nil {
+		return
+	}
+	parents := []Individual{Individual{}}
+	ga.Population, err = ga.mutate(parents, make([]int, popSize))
+	if err != nil {
+		return
+	}
+	sortByFitness(ga.Population)
+	err = ga.Materialize(ga.Population[0])
+	return
+}
+
+// Step makes the next generation from the fittest of this one, and leaves the params of sm at the fittest of the new generation.
+func (ga *GA) Step() (err error) {
+	truncation := ga.config.truncation
+	if truncation > len(ga.Population) {
+		truncation = len(ga.Population)
+	}
+	children, err := ga.mutate(ga.Population[:truncation], ga.chooseParents(truncation, len(ga.Population)-ga.config.elites))
+	if err != nil {
+		return
+	}
+	population := append(ga.Population[:ga.config.elites:ga.config.elites], children...)
+	sortByFitness(population)
+	ga.Population = population
+	ga.Generation++
+	err = ga.Materialize(ga.Population[0])
+	return
+}
+
+// sortByFitness sorts the individuals with the fittest first.
+func sortByFitness(individuals []Individual) {
+	sort.SliceStable(individuals, func(i, j int) bool { return individuals[i].Fitness > individuals[j].Fitness })
+}
+
+// chooseParents returns the indices of the parents of n children, chosen uniformly from numParents.
+// They are sorted, so that each parent need only be materialized once.
+func (b *breeder) chooseParents(numParents, n int) (parentIndices []int) {
+	parentIndices = make([]int, n)
+	for i := range parentIndices {
+		parentIndices[i] = b.rng.Intn(numParents)
+	}
+	sort.Ints(parentIndices)
+	return
+}
+
+// mutate makes a child of parents[i] for each i of parentIndices, which must be sorted, and evaluates them.
+func (b *breeder) mutate(parents []Individual, parentIndices []int) (children []Individual, err error) {
+	children = make([]Individual, len(parentIndices))
+	for start := 0; start < len(parentIndices); {
+		end := start
+		for end < len(parentIndices) && parentIndices[end] == parentIndices[start] {
+			end++
+		}
+		parent := parents[parentIndices[start]]
+		err = b.Materialize(parent)
+		if err != nil {
+			return
+		}
+		seeds := make([]int, end-start)
+		for i := range seeds {
+			seeds[i] = b.rng.Intn(b.numSeeds)
+		}
+		// the fitness of a seed is the fitness of the params of sm perturbed by it, which is the fitness of the child.
+		var fitness []float32
+		var behaviors [][]float32
+		fitness, behaviors, err = b.evaluate(seeds)
+		if err != nil {
+			return
+		}
+		for i, seed := range seeds {
+			childSeeds := make([]int64, len(parent.Seeds), len(parent.Seeds)+1)
+			copy(childSeeds, parent.Seeds)
+			children[start+i] = Individual{Seeds: append(childSeeds, int64(seed)), Fitness: fitness[i]}
+			if behaviors != nil {
+				children[start+i].Behavior = behaviors[i]
+			}
+		}
+		start = end
+	}
+	return
+}
+
+// Materialize sets the params of the state machine to those of the individual.
+// If it is at an ancestor of the individual, the remaining seeds are stepped, otherwise the params are reset and all the seeds are replayed.
+// It never rewinds, so the params are always exactly those of the lineage.
+func (b *breeder) Materialize(individual Individual) (err error) {
+	if !isPrefix(b.sm.Seeds, individual.Seeds) {
+		err = b.sm.replay(nil, nil, b.sigma)
+		if err != nil {
+			return
+		}
+	}
+	for _, seed := range individual.Seeds[len(b.sm.Seeds):] {
+		err = b.sm.Step(seed)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// isPrefix returns true if prefix is the start of seeds.
+func isPrefix(prefix, seeds []int64) bool {
+	if len(prefix) > len(seeds) {
+		return false
+	}
+	for i, seed := range prefix {
+		if seeds[i] != seed {
+			return false
+		}
+	}
+	return true
+}
+
+type gaOptimizer struct {
+	*GA
+}
+
+// NewGAOptimizer makes an Optimizer of ga. Its params are those of the fittest individual.
+func NewGAOptimizer(ga *GA) Optimizer {
+	return gaOptimizer{GA: ga}
+}
+
+func (o gaOptimizer) Generation() int64 {
+	return o.GA.Generation
+}
+
+func (o gaOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sm.sess.Run(nil, o.sm.params, nil)
+}
+
+func (o gaOptimizer) Close() error {
+	return o.sm.sess.Close()
+}
@@ -0,0 +1,72 @@
+package descend
+
+import (
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// makeGA makes a GA on the optimizer loss.
+func makeGA(t *testing.T, popSize int, options ...GAOption) (ga GA, ts testSM) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1000), withSMOptions(ChunkedEval(8)))
+	ga, err := NewGA(&sm, ts.fitness, popSize, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestGA(t *testing.T) {
+	ga, ts := makeGA(t, 30, WithTruncation(5), WithElites(2))
+	lastFitness := ga.Population[0].Fitness
+	for i := 0; i < 20; i++ {
+		err := ga.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ga.Population) != 30 {
+			t.Fatal("population is", len(ga.Population))
+		}
+		best := ga.Population[0]
+		if best.Fitness < lastFitness {
+			t.Fatal("the elite was lost", best.Fitness, lastFitness)
+		}
+		lastFitness = best.Fitness
+		// the params should have been left at the fittest individual.
+		results, err := ts.sess.Run(nil, []tf.Output{ts.loss}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff := results[0].Value().(float32) + best.Fitness
+		if diff > 1e-4 || diff < -1e-4 {
+			t.Fatal("materialized loss", results[0].Value(), "is not the negative of the fitness", best.Fitness)
+		}
+	}
+	if ga.Generation != 20 {
+		t.Fatal("generation is", ga.Generation)
+	}
+	if lastFitness < -15 { // the loss of the initial params is 30.
+		t.Fatal("GA did not learn", lastFitness)
+	}
+}
+
+func TestGAReproducible(t *testing.T) {
+	ga1, _ := makeGA(t, 10)
+	ga2, _ := makeGA(t, 10)
+	for i := 0; i < 5; i++ {
+		err := ga1.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ga2.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range ga1.Population {
+		if !reflect.DeepEqual(ga1.Population[i].Seeds, ga2.Population[i].Seeds) {
+			t.Fatal("populations differ", ga1.Population[i].Seeds, ga2.Population[i].Seeds)
+		}
+	}
+}
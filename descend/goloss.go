@@ -0,0 +1,150 @@
+package descend
+
+import (
+	"errors"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// GoLossFunc computes the loss of params in Go, for losses which can not be a TF subgraph, such as simulators or external scorers.
+type GoLossFunc func(params []*tf.Tensor) (loss float32, err error)
+
+// GoLoss lets a GoLossFunc serve as the loss of newBestSeed or newSeedWeights.
+// Each time its LossFunc is called, it keeps the params it was given, and returns a placeholder for their loss.
+// To evaluate the seeds, the params are fetched, their losses are computed in Go, and fed back to the placeholders.
+type GoLoss struct {
+	calls []goLossCall
+}
+
+// goLossCall is one call to the LossFunc of a GoLoss.
+type goLossCall struct {
+	params []tf.Output
+	loss   tf.Output
+}
+
+// NewGoLoss makes a GoLoss and the LossFunc to give to newBestSeed or newSeedWeights.
+// Give the LossFunc to only one of them, as the params of every call to it are fetched whenever the seeds are evaluated.
+// Without ChunkedEval, every seed (twice over if Mirrored) has its own call, and all of them are computed on each evaluation, so only the whole range of seeds can be evaluated.
+// With ChunkedEval, only the calls of the chunks of the seeds being evaluated are computed, so use it to shard seeds between workers, or for a GA.
+func NewGoLoss() (lossFunc LossFunc, goLoss *GoLoss) {
+	goLoss = &GoLoss{}
+	lossFunc = func(s *op.Scope, params []tf.Output) tf.Output {
+		loss := op.Placeholder(s.SubScope("go_loss"), tf.Float, op.PlaceholderShape(tf.ScalarShape()))
+		goLoss.calls = append(goLoss.calls, goLossCall{params: params, loss: loss})
+		return loss
+	}
+	return
+}
+
+// fetches returns the params of every call, to be fetched together.
+func (gl *GoLoss) fetches() (fetches []tf.Output) {
+	for _, call := range gl.calls {
+		fetches = append(fetches, call.params...)
+	}
+	return
+}
+
+// feedLosses computes the losses of the params of every call, fetched from fetches, with lossFunc, and adds them to feeds.
+func (gl *GoLoss) feedLosses(feeds map[tf.Output]*tf.Tensor, params []*tf.Tensor, lossFunc GoLossFunc) (err error) {
+	for _, call := range gl.calls {
+		var loss float32
+		loss, err = lossFunc(params[:len(call.params)])
+		if err != nil {
+			return
+		}
+		params = params[len(call.params):]
+		feeds[call.loss], err = tf.NewTensor(loss)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MakeFitnessFuncs is as MakeFitnessFuncs, but the losses are computed by lossFunc.
+// graph must have been filled in using ExportFitnessGraph by the newBestSeed or newSeedWeights which was given the LossFunc of gl.
+// The losses are computed one at a time, so lossFunc need not be safe to call concurrently.
+func (gl *GoLoss) MakeFitnessFuncs(sess *tf.Session, graph FitnessGraph, lossFunc GoLossFunc) (
+	evaluate func(seeds []int) ([]float32, error),
+	weigh func(fitness []float32) ([]float32, error),
+) {
+	_, weigh = MakeFitnessFuncs(sess, graph)
+	evaluate = func(seeds []int) (fitness []float32, err error) {
+		if graph.chunkSize > 0 {
+			fitness = make([]float32, 0, len(seeds)+graph.chunkSize)
+			err = runChunks(sess, nil, graph.SeedIndices, gl.fetches(), graph.chunkSize, seeds, func(chunkFeeds map[tf.Output]*tf.Tensor, params []*tf.Tensor) (err error) {
+				err = gl.feedLosses(chunkFeeds, params, lossFunc)
+				if err != nil {
+					return
+				}
+				results, err := sess.Run(chunkFeeds, []tf.Output{graph.ChunkFitness}, nil)
+				if err != nil {
+					return
+				}
+				fitness = append(fitness, results[0].Value().([]float32)...)
+				return
+			})
+			if err != nil {
+				return
+			}
+			fitness = fitness[:len(seeds)]
+			return
+		}
+		if !coversAll(seeds, graph.numSeeds) {
+			err = errors.New("descend: without ChunkedEval, a GoLoss computes the loss of every seed, so it can only evaluate all of them")
+			return
+		}
+		params, err := sess.Run(nil, gl.fetches(), nil)
+		if err != nil {
+			return
+		}
+		feeds := map[tf.Output]*tf.Tensor{}
+		err = gl.feedLosses(feeds, params, lossFunc)
+		if err != nil {
+			return
+		}
+		return evaluateSeeds(sess, graph, feeds, seeds)
+	}
+	return
+}
+
+// MakeBestSeed makes a func which returns the best seed, as the bestSeed func of a SeedSM does, but with the losses computed by lossFunc.
+// graph must have been filled in by the newBestSeed of the SeedSM using ExportFitnessGraph, and given the LossFunc of gl.
+func (gl *GoLoss) MakeBestSeed(sess *tf.Session, graph FitnessGraph, lossFunc GoLossFunc) func() (int64, error) {
+	evaluate, _ := gl.MakeFitnessFuncs(sess, graph, lossFunc)
+	return func() (seed int64, err error) {
+		fitness, err := evaluate(seedRange(graph.numSeeds))
+		if err != nil {
+			return
+		}
+		seed = fittestSeed(fitness)
+		return
+	}
+}
+
+// MakeSeedWeights makes a func which returns the seed weights, as the seedWeights func of a WeightedSeedSM does, but with the losses computed by lossFunc.
+// graph must have been filled in by the newSeedWeights of the WeightedSeedSM using ExportFitnessGraph, and given the LossFunc of gl.
+func (gl *GoLoss) MakeSeedWeights(sess *tf.Session, graph FitnessGraph, lossFunc GoLossFunc) func() ([]float32, error) {
+	evaluate, weigh := gl.MakeFitnessFuncs(sess, graph, lossFunc)
+	return func() (weights []float32, err error) {
+		fitness, err := evaluate(seedRange(graph.numSeeds))
+		if err != nil {
+			return
+		}
+		return weigh(fitness)
+	}
+}
+
+// coversAll returns true if seeds has every seed from 0 to n-1.
+func coversAll(seeds []int, n int) bool {
+	seen := make([]bool, n)
+	count := 0
+	for _, seed := range seeds {
+		if seed >= 0 && seed < n && !seen[seed] {
+			seen[seed] = true
+			count++
+		}
+	}
+	return count == n
+}
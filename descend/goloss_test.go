@@ -0,0 +1,105 @@
+package descend
+
+import (
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// makeGoLossEval makes the funcs to get the best seed and the seed weights, with the loss in the graph or in Go.
+func makeGoLossEval(t *testing.T, goLoss bool, options ...SMOption) (bestSeed func() (int64, error), seedWeights func() ([]float32, error), step func(int64) error) {
+	seedOptions := []testOption{withNoise(MakeNoise(0.03)), withSMOptions(options...)}
+	weightsOptions := []testOption{withNoise(MakeNoise(0.03)), withSMOptions(options...)}
+	var seedGoLoss, weightsGoLoss *GoLoss
+	if goLoss {
+		var seedLossFunc, weightsLossFunc LossFunc
+		seedLossFunc, seedGoLoss = NewGoLoss()
+		weightsLossFunc, weightsGoLoss = NewGoLoss()
+		seedOptions = append(seedOptions, withEvalLoss(seedLossFunc))
+		weightsOptions = append(weightsOptions, withEvalLoss(weightsLossFunc))
+	}
+	seedSM, seedTS := newTestSeedSM(t, seedOptions...)
+	_, weightsTS := newTestWeightedSeedSM(t, weightsOptions...)
+	step = seedSM.Step
+	if goLoss {
+		bestSeed = seedGoLoss.MakeBestSeed(seedTS.sess, seedTS.fitness, optimizerGoLoss)
+		seedWeights = weightsGoLoss.MakeSeedWeights(weightsTS.sess, weightsTS.fitness, optimizerGoLoss)
+		return
+	}
+	return seedTS.bestSeed, weightsTS.seedWeights, step
+}
+
+func testGoLoss(t *testing.T, options ...SMOption) {
+	bestSeed, seedWeights, step := makeGoLossEval(t, false, options...)
+	goBestSeed, goSeedWeights, goStep := makeGoLossEval(t, true, options...)
+	for i := 0; i < 5; i++ {
+		seed, err := bestSeed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		goSeed, err := goBestSeed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed != goSeed {
+			t.Fatal("best seeds are different", seed, goSeed)
+		}
+		weights, err := seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		goWeights, err := goSeedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range weights {
+			diff := weights[j] - goWeights[j]
+			if diff > 1e-3 || diff < -1e-3 {
+				t.Fatal("weights are different", weights, goWeights)
+			}
+		}
+		// move the params, so that the next seeds are evaluated somewhere else.
+		err = step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = goStep(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGoLoss(t *testing.T) {
+	testGoLoss(t)
+}
+
+func TestGoLossChunked(t *testing.T) {
+	testGoLoss(t, ChunkedEval(2))
+}
+
+// evaluateGoLossSubset evaluates seeds 2 and 4 of 5 with a GoLoss, and returns how many times the Go loss was computed.
+func evaluateGoLossSubset(t *testing.T, options ...SMOption) (calls int, err error) {
+	lossFunc, goLoss := NewGoLoss()
+	_, ts := newTestSeedSM(t, withNoise(MakeNoise(0.03)), withSMOptions(options...), withEvalLoss(lossFunc))
+	evaluate, _ := goLoss.MakeFitnessFuncs(ts.sess, ts.fitness, func(params []*tf.Tensor) (float32, error) {
+		calls++
+		return optimizerGoLoss(params)
+	})
+	_, err = evaluate([]int{2, 4})
+	return
+}
+
+func TestGoLossSubset(t *testing.T) {
+	_, err := evaluateGoLossSubset(t)
+	if err == nil {
+		t.Fatal("expected an error for a subset of the seeds without ChunkedEval")
+	}
+	calls, err := evaluateGoLossSubset(t, ChunkedEval(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatal("expected the loss of 2 seeds to be computed, got", calls)
+	}
+}
@@ -0,0 +1,98 @@
+package descend
+
+import (
+	"errors"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// GradientSM moves through parameter space by following the gradient of the loss, as computed by backpropagation.
+// It uses the same param defs, loss funcs and update rules as the ES state machines, so that the two can be compared on the same models.
+type GradientSM struct {
+	Generation int64
+	Loss       float32 // the loss before the last step.
+	sess       *tf.Session
+	step       []*tf.Operation
+	loss       tf.Output
+	params     []tf.Output
+}
+
+// Step computes the gradient of the loss, and moves the params according to the update rule.
+func (sm *GradientSM) Step() (err error) {
+	results, err := sm.sess.Run(nil, []tf.Output{sm.loss}, sm.step)
+	if err != nil {
+		return
+	}
+	sm.Generation++
+	sm.Loss = results[0].Value().(float32)
+	return
+}
+
+// NewGradientSM creates TF OPs for a state machine which minimizes the loss by gradient descent.
+// Every OP in the loss func must have a registered gradient.
+func NewGradientSM(s *op.Scope,
+	paramDefs []ParamDef,
+	lossFunc LossFunc,
+	rule UpdateRule,
+) (
+	makeGradientSM func(*tf.Session) (GradientSM, error),
+	generation tf.Output,
+	params []tf.Output,
+) {
+	if rule == nil {
+		s.UpdateErr("NewGradientSM", errors.New("update rule must not be nil"))
+		return
+	}
+	ns := namespace(s, "NewGradientSM", paramDefs)
+	generationScope := s.SubScope("generation")
+	generationVar := op.VarHandleOp(generationScope, tf.Int64, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "generation")))
+	initGeneration := op.AssignVariableOp(generationScope.SubScope("init"), generationVar, op.Const(generationScope.SubScope("zero"), int64(0)))
+	generation = op.ReadVariableOp(generationScope, generationVar, tf.Int64)
+	nextGen := op.Add(generationScope, generation, op.Const(generationScope.SubScope("one"), int64(1)))
+
+	paramCount := len(paramDefs)
+	varHandles := make([]tf.Output, paramCount)
+	zeroParams := make([]tf.Output, paramCount)
+	params = make([]tf.Output, paramCount)
+	initOps := []*tf.Operation{initGeneration}
+	for i, pd := range paramDefs {
+		paramScope := s.SubScope(pd.Name)
+		zeroParams[i] = pd.Init(paramScope.SubScope("init_val"))
+		varHandles[i] = op.VarHandleOp(paramScope, zeroParams[i].DataType(), zeroParams[i].Shape(), op.VarHandleOpSharedName(sharedName(ns, pd.Name)))
+		initOps = append(initOps, op.AssignVariableOp(paramScope, varHandles[i], zeroParams[i]))
+		params[i] = op.ReadVariableOp(paramScope, varHandles[i], zeroParams[i].DataType())
+	}
+	loss := lossFunc(s.SubScope("loss"), params)
+	grads := op.Gradients(s.SubScope("gradients"), []tf.Output{loss}, params)
+	if s.Err() != nil {
+		return
+	}
+	step := []*tf.Operation{op.AssignVariableOp(generationScope.SubScope("update"), generationVar, nextGen)}
+	for i, pd := range paramDefs {
+		if pd.Frozen {
+			continue
+		}
+		paramScope := s.SubScope(pd.Name + "_step")
+		// update rules expect the direction which reduces the loss.
+		descent := op.Neg(paramScope, grads[i])
+		update, stateUpdates, initState := rule(paramScope.SubScope("update_rule"), sharedName(ns, pd.Name), zeroParams[i], descent, nextGen)
+		step = append(step, op.AssignAddVariableOp(paramScope, varHandles[i], update))
+		step = append(step, stateUpdates...)
+		initOps = append(initOps, initState...)
+	}
+	makeGradientSM = func(sess *tf.Session) (sm GradientSM, err error) {
+		_, err = sess.Run(nil, nil, initOps)
+		if err != nil {
+			return
+		}
+		sm = GradientSM{
+			sess:   sess,
+			step:   step,
+			loss:   loss,
+			params: params,
+		}
+		return
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package descend
+
+import (
+	"testing"
+
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestGradientSMtrain(t *testing.T) {
+	for _, rule := range []UpdateRule{SGD(0.01), Momentum(0.01, 0.9), Adam(0.02, 0.9, 0.999, 1e-8)} {
+		s := op.NewScope()
+		lossFunc, paramDefs := makeOptimizerLoss(s)
+		makeGradientSM, generation, params := NewGradientSM(s.SubScope("sm"), paramDefs, lossFunc, rule)
+		sess, _ := newTestSession(t, s)
+		sm, err := makeGradientSM(sess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 500; i++ {
+			err = sm.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		results, err := sess.Run(nil, append(params, generation), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[2].Value().(int64) != 500 {
+			t.Fatal("bad generation", results[2].Value())
+		}
+		checkFitted(t, readParams(t, sess, params))
+	}
+}
+
+func TestGradientSMFrozen(t *testing.T) {
+	s := op.NewScope()
+	lossFunc, paramDefs := makeOptimizerLoss(s)
+	paramDefs[1].Frozen = true
+	makeGradientSM, _, params := NewGradientSM(s.SubScope("gradient_sm"), paramDefs, lossFunc, SGD(0.01))
+	sess, _ := newTestSession(t, s)
+	sm, err := makeGradientSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err = sm.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	values := readParams(t, sess, params)
+	if values[0].(float32) == 0 || values[1].(float32) != 0 {
+		t.Fatal("only the weight should have moved", values)
+	}
+}
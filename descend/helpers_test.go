@@ -0,0 +1,211 @@
+package descend
+
+import (
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// testSM holds what a test needs of a state machine made by newTestSeedSM or newTestWeightedSeedSM, apart from the state machine itself.
+type testSM struct {
+	sess        *tf.Session
+	graph       *tf.Graph
+	generation  tf.Output
+	params      []tf.Output
+	loss        tf.Output                 // the loss of the params, if the state machine has a loss.
+	fitness     FitnessGraph              // the graph of the seed evaluator, if it has one.
+	bestSeed    func() (int64, error)     // the seed evaluator of a SeedSM.
+	seedWeights func() ([]float32, error) // the seed evaluator of a WeightedSeedSM.
+}
+
+type testConfig struct {
+	paramDefs   []ParamDef
+	lossFunc    LossFunc
+	evalLoss    LossFunc
+	noise       NoiseFunc
+	numSeeds    int
+	smOptions   []SMOption
+	evalOptions []SeedWeightsOption
+	seedWeight  func(*op.Scope) tf.Output
+}
+
+// testOption changes the state machine which newTestSeedSM or newTestWeightedSeedSM makes.
+type testOption func(*testConfig)
+
+// makeTestConfig defaults to the params and loss of makeOptimizerLoss, 5 seeds, noise with a stdev of 0.003, and a seed weight of 100.
+func makeTestConfig(s *op.Scope, options []testOption) (config testConfig) {
+	config.lossFunc, config.paramDefs = makeOptimizerLoss(s)
+	config.evalLoss = config.lossFunc
+	config.noise = MakeNoise(0.003)
+	config.numSeeds = 5
+	config.seedWeight = func(s *op.Scope) tf.Output {
+		return op.Const(s, float32(100))
+	}
+	for _, option := range options {
+		option(&config)
+	}
+	return
+}
+
+// withParamDefs makes the state machine on paramDefs, with no loss and no seed evaluator.
+func withParamDefs(paramDefs []ParamDef) testOption {
+	return func(c *testConfig) {
+		c.paramDefs = paramDefs
+		c.lossFunc = nil
+		c.evalLoss = nil
+	}
+}
+
+// withEvalLoss makes the seed evaluator use lossFunc, such as that of a GoLoss, instead of the loss of the params.
+func withEvalLoss(lossFunc LossFunc) testOption {
+	return func(c *testConfig) {
+		c.evalLoss = lossFunc
+	}
+}
+
+func withNoise(noise NoiseFunc) testOption {
+	return func(c *testConfig) {
+		c.noise = noise
+	}
+}
+
+func withNumSeeds(numSeeds int) testOption {
+	return func(c *testConfig) {
+		c.numSeeds = numSeeds
+	}
+}
+
+func withSMOptions(options ...SMOption) testOption {
+	return func(c *testConfig) {
+		c.smOptions = append(c.smOptions, options...)
+	}
+}
+
+func withEvalOptions(options ...SeedWeightsOption) testOption {
+	return func(c *testConfig) {
+		c.evalOptions = append(c.evalOptions, options...)
+	}
+}
+
+// withSeedWeight makes the seed weight of a WeightedSeedSM in the scope it is given.
+func withSeedWeight(seedWeight func(*op.Scope) tf.Output) testOption {
+	return func(c *testConfig) {
+		c.seedWeight = seedWeight
+	}
+}
+
+// newTestSession finalizes s, and starts a session on its graph.
+func newTestSession(t *testing.T, s *op.Scope) (sess *tf.Session, graph *tf.Graph) {
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err = tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// start adds the loss of params to s, and starts a session on it.
+func (ts *testSM) start(t *testing.T, s *op.Scope, config testConfig, params []tf.Output) {
+	ts.params = params
+	if config.lossFunc != nil {
+		ts.loss = config.lossFunc(s.SubScope("loss"), params)
+	}
+	ts.sess, ts.graph = newTestSession(t, s)
+}
+
+// newTestSeedSM makes a SeedSM, by default on the params of makeOptimizerLoss with a seed evaluator.
+func newTestSeedSM(t *testing.T, options ...testOption) (sm SeedSM, ts testSM) {
+	s := op.NewScope()
+	config := makeTestConfig(s, options)
+	makeSM, newBestSeed, generation, params := NewSeedSM(s.SubScope("sm"), config.noise, config.paramDefs, config.numSeeds, config.smOptions...)
+	var makeBestSeed func(*tf.Session) (func() (int64, error), error)
+	if config.evalLoss != nil {
+		makeBestSeed = newBestSeed(config.evalLoss, append(config.evalOptions, ExportFitnessGraph(&ts.fitness))...)
+	}
+	ts.generation = generation
+	ts.start(t, s, config, params)
+	sm, err := makeSM(ts.sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if makeBestSeed != nil {
+		ts.bestSeed, err = makeBestSeed(ts.sess)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// newTestWeightedSeedSM makes a WeightedSeedSM, by default on the params of makeOptimizerLoss with a seed evaluator.
+func newTestWeightedSeedSM(t *testing.T, options ...testOption) (sm WeightedSeedSM, ts testSM) {
+	s := op.NewScope()
+	config := makeTestConfig(s, options)
+	makeSM, newSeedWeights, generation, params := NewWeightedSeedSM(s.SubScope("sm"), config.noise, config.paramDefs, config.numSeeds, config.smOptions...)
+	var makeSeedWeights func(*tf.Session) (func() ([]float32, error), error)
+	if config.evalLoss != nil {
+		seedWeight := config.seedWeight(s.SubScope("seed_weight"))
+		makeSeedWeights = newSeedWeights(config.evalLoss, seedWeight, append(config.evalOptions, ExportFitnessGraph(&ts.fitness))...)
+	}
+	ts.generation = generation
+	ts.start(t, s, config, params)
+	sm, err := makeSM(ts.sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if makeSeedWeights != nil {
+		ts.seedWeights, err = makeSeedWeights(ts.sess)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// checkFitted fails unless values, the params of makeOptimizerLoss, are close to the weight of -1 and bias of 1 which fit it.
+func checkFitted(t *testing.T, values []interface{}) {
+	weight := values[0].(float32)
+	bias := values[1].(float32)
+	if weight < -1.1 || weight > -0.9 || bias < 0.9 || bias > 1.1 {
+		t.Fatal("weight", weight, "and bias", bias, "are not ~-1 and ~1")
+	}
+}
+
+// readParams reads the values of outputs.
+func readParams(t *testing.T, sess *tf.Session, outputs []tf.Output) (values []interface{}) {
+	tensors, err := sess.Run(nil, outputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tensor := range tensors {
+		values = append(values, tensor.Value())
+	}
+	return
+}
+
+// tolerance is how far apart two float32s may be and still be close.
+// Rewinds, replays and sums in a different order do not round the same way.
+const tolerance = 1e-5
+
+// paramsClose reports whether a and b are float32s, or slices of the same length of them or of such slices, which are all within tolerance of each other.
+func paramsClose(a, b interface{}) bool {
+	if a, ok := a.(float32); ok {
+		b, ok := b.(float32)
+		return ok && a-b < tolerance && b-a < tolerance
+	}
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	if aValue.Kind() != reflect.Slice || bValue.Kind() != reflect.Slice || aValue.Len() != bValue.Len() {
+		return false
+	}
+	for i := 0; i < aValue.Len(); i++ {
+		if !paramsClose(aValue.Index(i).Interface(), bValue.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package descend
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// Variables with the same shared name are the same variable, so every state machine gives its variables shared names under the namespace of its scope.
+// Two state machines made in different sub scopes can then live side by side in one graph.
+// Within a namespace, a param is named after its ParamDef, and the state kept for a param, such as that of its update rule or moving average, or the sum of its noise for a chunked step, is named after the param, then a "/", then the name of the state.
+// So that no param can share a variable with anything else, param names must not contain a "/", and must not be one of reservedNames.
+
+// reservedNames are the names of the variables which state machines keep for themselves.
+var reservedNames = []string{"generation", "sigma"}
+
+// namespace returns the namespace of s, under which a state machine made in s names its variables.
+// It sets an error on s if another state machine has already been made in s, if two of the params have the same name, or if a param name could be that of another variable.
+func namespace(s *op.Scope, fn string, paramDefs []ParamDef) (ns string) {
+	probe := op.NoOp(s.SubScope("shared_names"))
+	if probe == nil { // s already has an error.
+		return
+	}
+	dir := path.Dir(probe.Name())
+	if path.Base(dir) != "shared_names" { // SubScope had to make the name unique.
+		s.UpdateErr(fn, fmt.Errorf("descend: scope %q already has a state machine in it, give each state machine its own SubScope", path.Dir(dir)))
+		return
+	}
+	ns = path.Dir(dir)
+	if ns == "." { // the root scope
+		ns = ""
+	}
+	seen := map[string]bool{}
+	for _, name := range reservedNames {
+		seen[name] = true
+	}
+	for _, pd := range paramDefs {
+		if strings.Contains(pd.Name, "/") {
+			s.UpdateErr(fn, fmt.Errorf("descend: param %q has a / in its name, which is kept for the names of its state", pd.Name))
+			return
+		}
+		if seen[pd.Name] {
+			s.UpdateErr(fn, fmt.Errorf("descend: two params or variables are named %q, param names must be unique and not one of %v", pd.Name, reservedNames))
+			return
+		}
+		seen[pd.Name] = true
+	}
+	return
+}
+
+// sharedName returns the shared name of the variable called name, in namespace ns.
+func sharedName(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + "/" + name
+}
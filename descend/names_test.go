@@ -0,0 +1,130 @@
+package descend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/is8ac/tfutils"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func TestSideBySideSMs(t *testing.T) {
+	s := op.NewScope()
+	noise := MakeNoise(0.003)
+	// all of them have the same param names.
+	makeSeedSM1, _, generation1, params1 := NewSeedSM(s.SubScope("sm"), noise, checkpointParamDefs, 3)
+	makeSeedSM2, _, generation2, params2 := NewSeedSM(s.SubScope("sm"), noise, checkpointParamDefs, 3)
+	makeWeightedSM, _, generation3, params3 := NewWeightedSeedSM(s.SubScope("weighted_sm"), noise, checkpointParamDefs, 3, WithUpdateRule(Momentum(0.1, 0.9)))
+	makeGradientSM, generation4, params4 := NewGradientSM(s.SubScope("gradient_sm"), checkpointParamDefs, func(s *op.Scope, params []tf.Output) tf.Output {
+		return op.Square(s, op.Sub(s, params[1], op.Const(s.SubScope("target"), float32(3))))
+	}, Momentum(0.1, 0.9))
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedSM1, err := makeSeedSM1(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedSM2, err := makeSeedSM2(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weightedSM, err := makeWeightedSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gradientSM, err := makeGradientSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeros := readParams(t, sess, params2)
+	for i := 0; i < 3; i++ {
+		err = seedSM1.Step(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = weightedSM.Step([]float32{1, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = gradientSM.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(readParams(t, sess, params2), zeros) {
+		t.Fatal("stepping one state machine changed the params of another")
+	}
+	moved := [][]interface{}{readParams(t, sess, params1), readParams(t, sess, params3), readParams(t, sess, params4)}
+	for i := 0; i < len(moved); i++ {
+		for j := i + 1; j < len(moved); j++ {
+			if reflect.DeepEqual(moved[i], moved[j]) {
+				t.Fatal("two state machines have the same params")
+			}
+		}
+	}
+	generations, err := sess.Run(nil, []tf.Output{generation1, generation2, generation3, generation4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int64{3, 0, 3, 3} {
+		if generations[i].Value().(int64) != expected {
+			t.Fatal("generation of state machine", i, "is", generations[i].Value(), "not", expected)
+		}
+	}
+	// the second can still be stepped on its own.
+	before := readParams(t, sess, params1)
+	err = seedSM2.Step(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(readParams(t, sess, params2), zeros) {
+		t.Fatal("the second state machine did not step")
+	}
+	if !reflect.DeepEqual(readParams(t, sess, params1), before) {
+		t.Fatal("stepping the second state machine changed the params of the first")
+	}
+}
+
+func TestSMNameCollisions(t *testing.T) {
+	s := op.NewScope()
+	smScope := s.SubScope("sm")
+	NewSeedSM(smScope, MakeNoise(0.003), checkpointParamDefs, 3)
+	NewWeightedSeedSM(smScope, MakeNoise(0.003), checkpointParamDefs, 3) // in the same scope as the first.
+	_, err := s.Finalize()
+	if err == nil {
+		t.Fatal("expected an error for two state machines in one scope")
+	}
+
+	s = op.NewScope()
+	paramDefs := []ParamDef{
+		ParamDef{Name: "weights", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+		ParamDef{Name: "weights", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+	}
+	NewSeedSM(s.SubScope("sm"), MakeNoise(0.003), paramDefs, 3)
+	_, err = s.Finalize()
+	if err == nil {
+		t.Fatal("expected an error for two params with the same name")
+	}
+}
+
+func TestReservedParamNames(t *testing.T) {
+	for _, name := range []string{"sigma", "generation", "weights/adam_m"} {
+		s := op.NewScope()
+		paramDefs := []ParamDef{
+			ParamDef{Name: "weights", Init: tfutils.Zero(tf.Float, tf.MakeShape(1, 2))},
+			ParamDef{Name: name, Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+		}
+		NewWeightedSeedSM(s.SubScope("sm"), MakeNoise(0.003), paramDefs, 3, WithUpdateRule(Adam(0.01, 0.9, 0.999, 1e-8)))
+		_, err := s.Finalize()
+		if err == nil {
+			t.Fatalf("expected an error for a param named %q", name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package descend
+
+import (
+	"math"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// All the noise funcs here are built on stateless random ops, so the same seed and generation always give the same noise, and SeedSM can replay and rewind them.
+
+// maskGenOffset is added to the generation to key the random numbers of a mask, so that they are independent of the noise, which uses the same seed.
+const maskGenOffset int64 = 1 << 62
+
+// uniform makes uniform random numbers in [0, 1) keyed by gen and seed.
+func uniform(s *op.Scope, shape, seed, gen tf.Output) tf.Output {
+	noiseSeed := op.Pack(s, []tf.Output{gen, seed})
+	return op.StatelessRandomUniform(s, shape, noiseSeed, op.StatelessRandomUniformDtype(tf.Float))
+}
+
+// MakeUniformNoise returns a NoiseFunc which makes uniform noise with the given standard deviation.
+func MakeUniformNoise(stdev float32) NoiseFunc {
+	return func(s *op.Scope, shape, seed, gen tf.Output) tf.Output {
+		// a uniform distribution in [-a, a) has a standard deviation of a/sqrt(3).
+		halfWidth := op.Const(s.SubScope("half_width"), stdev*float32(math.Sqrt(3)))
+		oneNoise := op.Sub(s, op.Mul(s.SubScope("double"), uniform(s, shape, seed, gen), op.Const(s.SubScope("two"), float32(2))), op.Const(s.SubScope("one"), float32(1)))
+		return op.Mul(s, oneNoise, halfWidth)
+	}
+}
+
+// MakeRademacherNoise returns a NoiseFunc which makes noise in which every value is either stdev or -stdev.
+func MakeRademacherNoise(stdev float32) NoiseFunc {
+	return func(s *op.Scope, shape, seed, gen tf.Output) tf.Output {
+		two := op.Const(s.SubScope("two"), float32(2))
+		bits := op.Floor(s, op.Mul(s.SubScope("double"), uniform(s, shape, seed, gen), two)) // 0 or 1
+		signs := op.Sub(s, op.Mul(s.SubScope("scale"), bits, two), op.Const(s.SubScope("one"), float32(1)))
+		return op.Mul(s, signs, op.Const(s.SubScope("stdev"), stdev))
+	}
+}
+
+// MakeSparseNoise returns a NoiseFunc which makes normal noise with the given standard deviation, but with only a density fraction of the values non zero.
+// The standard deviation of the non zero values is not changed, so the noise as a whole is smaller.
+func MakeSparseNoise(stdev float32, density float32) NoiseFunc {
+	noise := MakeNoise(stdev)
+	return func(s *op.Scope, shape, seed, gen tf.Output) tf.Output {
+		maskGen := op.Add(s.SubScope("mask_gen"), gen, op.Const(s.SubScope("mask_gen_offset"), maskGenOffset))
+		keep := op.Less(s, uniform(s.SubScope("mask"), shape, seed, maskGen), op.Const(s.SubScope("density"), density))
+		mask := op.Cast(s, keep, tf.Float)
+		return op.Mul(s, noise(s.SubScope("noise"), shape, seed, gen), mask)
+	}
+}
+
+// MakeLowRankNoise returns a NoiseFunc which makes noise of the given rank for matrix params, by multiplying a [rows, rank] and a [rank, cols] matrix of normal noise.
+// It is scaled so that each value has the given standard deviation.
+// Params which are not matrices get full rank normal noise, as from MakeNoise.
+// As the noise only needs (rows+cols)*rank random numbers, it is much cheaper to make for large matrices.
+func MakeLowRankNoise(stdev float32, rank int) NoiseFunc {
+	fullRank := MakeNoise(stdev)
+	return func(s *op.Scope, shape, seed, gen tf.Output) tf.Output {
+		if shape.Shape().NumDimensions() != 1 || shape.Shape().Size(0) != 2 {
+			return fullRank(s, shape, seed, gen)
+		}
+		k := op.Const(s.SubScope("rank"), []int32{int32(rank)})
+		rows := op.Slice(s.SubScope("rows"), shape, op.Const(s.SubScope("rows_begin"), []int32{0}), op.Const(s.SubScope("rows_size"), []int32{1}))
+		cols := op.Slice(s.SubScope("cols"), shape, op.Const(s.SubScope("cols_begin"), []int32{1}), op.Const(s.SubScope("cols_size"), []int32{1}))
+		rowsSize := op.Mul(s.SubScope("rows_size"), rows, k)
+		colsSize := op.Mul(s.SubScope("cols_size"), cols, k)
+		// we make all the noise in one go, and then split it into the two factors.
+		flat := MakeNoise(1)(s.SubScope("flat"), op.Add(s.SubScope("flat_size"), rowsSize, colsSize), seed, gen)
+		zero := op.Const(s.SubScope("zero"), []int32{0})
+		left := op.Reshape(s.SubScope("left"), op.Slice(s.SubScope("left_slice"), flat, zero, rowsSize), op.Concat(s.SubScope("left_shape"), op.Const(s.SubScope("left_axis"), int32(0)), []tf.Output{rows, k}))
+		right := op.Reshape(s.SubScope("right"), op.Slice(s.SubScope("right_slice"), flat, rowsSize, colsSize), op.Concat(s.SubScope("right_shape"), op.Const(s.SubScope("right_axis"), int32(0)), []tf.Output{k, cols}))
+		// each value is the sum of rank products of two unit normals, so it has a standard deviation of sqrt(rank).
+		scale := op.Const(s.SubScope("scale"), stdev/float32(math.Sqrt(float64(rank))))
+		return op.Mul(s, op.MatMul(s, left, right), scale)
+	}
+}
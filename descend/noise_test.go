@@ -0,0 +1,154 @@
+package descend
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// makeNoiseValues makes noise of shape [rows, cols] for each of the seeds.
+func makeNoiseValues(t *testing.T, noise NoiseFunc, rows, cols int32, seeds ...int64) (values [][][]float32) {
+	s := op.NewScope()
+	shape := op.Const(s.SubScope("shape"), []int32{rows, cols})
+	gen := op.Const(s.SubScope("gen"), int64(3))
+	outputs := make([]tf.Output, len(seeds))
+	for i, seed := range seeds {
+		outputs[i] = noise(s.SubScope("noise"), shape, op.Const(s.SubScope("seed"), seed), gen)
+	}
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sess.Run(nil, outputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		values = append(values, result.Value().([][]float32))
+	}
+	return
+}
+
+// stdev returns the standard deviation of the values, and the fraction of them which are zero.
+func stdev(values [][]float32) (sd float64, zeros float64) {
+	var sum, sumSq, n float64
+	for _, row := range values {
+		for _, v := range row {
+			sum += float64(v)
+			sumSq += float64(v) * float64(v)
+			n++
+			if v == 0 {
+				zeros++
+			}
+		}
+	}
+	mean := sum / n
+	return math.Sqrt(sumSq/n - mean*mean), zeros / n
+}
+
+func TestNoiseFuncs(t *testing.T) {
+	noises := map[string]NoiseFunc{
+		"normal":     MakeNoise(0.1),
+		"uniform":    MakeUniformNoise(0.1),
+		"rademacher": MakeRademacherNoise(0.1),
+		"low_rank":   MakeLowRankNoise(0.1, 16),
+	}
+	for name, noise := range noises {
+		values := makeNoiseValues(t, noise, 100, 50, 7, 7, 8)
+		if !reflect.DeepEqual(values[0], values[1]) {
+			t.Fatal(name, "is different for the same seed")
+		}
+		if reflect.DeepEqual(values[0], values[2]) {
+			t.Fatal(name, "is the same for different seeds")
+		}
+		sd, _ := stdev(values[0])
+		if sd < 0.09 || sd > 0.11 {
+			t.Fatal(name, "has a standard deviation of", sd, "not ~0.1")
+		}
+	}
+}
+
+func TestRademacherNoise(t *testing.T) {
+	values := makeNoiseValues(t, MakeRademacherNoise(0.5), 10, 10, 1)
+	for _, row := range values[0] {
+		for _, v := range row {
+			if v != 0.5 && v != -0.5 {
+				t.Fatal("value is not ±0.5:", v)
+			}
+		}
+	}
+}
+
+func TestSparseNoise(t *testing.T) {
+	values := makeNoiseValues(t, MakeSparseNoise(0.1, 0.2), 100, 50, 1)
+	_, zeros := stdev(values[0])
+	if zeros < 0.75 || zeros > 0.85 {
+		t.Fatal("fraction of zeros is", zeros, "not ~0.8")
+	}
+}
+
+func TestLowRankNoise(t *testing.T) {
+	values := makeNoiseValues(t, MakeLowRankNoise(0.1, 1), 5, 4, 1)
+	m := values[0]
+	// if the rank is 1, every 2x2 minor is 0.
+	for i := range m {
+		for j := range m[i] {
+			minor := m[i][j]*m[0][0] - m[i][0]*m[0][j]
+			if minor > 1e-6 || minor < -1e-6 {
+				t.Fatal("noise is not rank 1", m)
+			}
+		}
+	}
+}
+
+func TestNoiseFuncsReplay(t *testing.T) {
+	noises := []NoiseFunc{
+		MakeUniformNoise(0.1),
+		MakeRademacherNoise(0.1),
+		MakeSparseNoise(0.1, 0.3),
+		MakeLowRankNoise(0.1, 1),
+	}
+	for _, noise := range noises {
+		sm1, ts1 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+		sm2, ts2 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+		initial := readParams(t, ts1.sess, ts1.params)
+		for _, seed := range []int64{3, 1, 4} {
+			err := sm1.Step(seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		buf := &bytes.Buffer{}
+		err := sm1.Save(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm2.Load(buf) // checks that the replayed params are exactly the same.
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+			t.Fatal("replayed params are different")
+		}
+		for i := 0; i < 3; i++ {
+			err = sm1.Rewind()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rewound := readParams(t, ts1.sess, ts1.params)
+		for i := range initial {
+			if !paramsClose(initial[i], rewound[i]) {
+				t.Fatal("rewinding did not return to the initial params", initial, rewound)
+			}
+		}
+	}
+}
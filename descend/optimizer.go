@@ -0,0 +1,128 @@
+package descend
+
+import (
+	"io"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Optimizer is anything which can move the params towards a lower loss one generation at a time.
+// The state machines each have their own API, so use the New*Optimizer funcs to wrap them.
+type Optimizer interface {
+	Step() error                   // evaluates the loss and takes one step.
+	Generation() int64             // how many steps have been taken.
+	Params() ([]*tf.Tensor, error) // reads the current values of the params.
+	Close() error                  // closes the session of the optimizer.
+}
+
+// Checkpointer is an Optimizer which can also save and load its state.
+// The optimizers of SeedSM and WeightedSeedSM are Checkpointers.
+type Checkpointer interface {
+	Optimizer
+	Save(io.Writer) error
+	Load(io.Reader) error
+}
+
+type seedOptimizer struct {
+	*SeedSM
+	bestSeed func() (int64, error)
+}
+
+// NewSeedOptimizer makes an Optimizer which steps sm by the seed which bestSeed returns.
+func NewSeedOptimizer(sm *SeedSM, bestSeed func() (int64, error)) Checkpointer {
+	return seedOptimizer{SeedSM: sm, bestSeed: bestSeed}
+}
+
+func (o seedOptimizer) Step() (err error) {
+	seed, err := o.bestSeed()
+	if err != nil {
+		return
+	}
+	err = o.SeedSM.Step(seed)
+	return
+}
+
+func (o seedOptimizer) Generation() int64 {
+	return o.SeedSM.Generation
+}
+
+func (o seedOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sess.Run(nil, o.params, nil)
+}
+
+func (o seedOptimizer) Close() error {
+	return o.sess.Close()
+}
+
+type weightedSeedOptimizer struct {
+	*WeightedSeedSM
+	seedWeights func() ([]float32, error)
+}
+
+// NewWeightedSeedOptimizer makes an Optimizer which steps sm by the weights which seedWeights returns.
+func NewWeightedSeedOptimizer(sm *WeightedSeedSM, seedWeights func() ([]float32, error)) Checkpointer {
+	return weightedSeedOptimizer{WeightedSeedSM: sm, seedWeights: seedWeights}
+}
+
+func (o weightedSeedOptimizer) Step() (err error) {
+	weights, err := o.seedWeights()
+	if err != nil {
+		return
+	}
+	err = o.WeightedSeedSM.Step(weights)
+	return
+}
+
+func (o weightedSeedOptimizer) Generation() int64 {
+	return o.WeightedSeedSM.Generation
+}
+
+func (o weightedSeedOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sess.Run(nil, o.params, nil)
+}
+
+func (o weightedSeedOptimizer) Close() error {
+	return o.sess.Close()
+}
+
+type cmaesOptimizer struct {
+	*CMAES
+}
+
+// NewCMAESOptimizer makes an Optimizer of sm.
+func NewCMAESOptimizer(sm *CMAES) Optimizer {
+	return cmaesOptimizer{CMAES: sm}
+}
+
+func (o cmaesOptimizer) Generation() int64 {
+	return o.CMAES.Generation
+}
+
+func (o cmaesOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sess.Run(nil, o.params, nil)
+}
+
+func (o cmaesOptimizer) Close() error {
+	return o.sess.Close()
+}
+
+type gradientOptimizer struct {
+	*GradientSM
+}
+
+// NewGradientOptimizer makes an Optimizer of sm.
+func NewGradientOptimizer(sm *GradientSM) Optimizer {
+	return gradientOptimizer{GradientSM: sm}
+}
+
+func (o gradientOptimizer) Generation() int64 {
+	return o.GradientSM.Generation
+}
+
+func (o gradientOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sess.Run(nil, o.params, nil)
+}
+
+func (o gradientOptimizer) Close() error {
+	return o.sess.Close()
+}
@@ -0,0 +1,117 @@
+package descend
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/is8ac/tfutils"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func makeOptimizerLoss(s *op.Scope) (lossFunc LossFunc, paramDefs []ParamDef) {
+	y := op.Const(s.SubScope("x"), []float32{1, 2, 3, 4})
+	x := op.Const(s.SubScope("y"), []float32{0, -1, -2, -3})
+	lossFunc = func(s *op.Scope, params []tf.Output) (loss tf.Output) {
+		actual := op.Add(s, params[1], op.Mul(s, x, params[0]))
+		return op.Sum(s, op.SquaredDifference(s, y, actual), op.Const(s.SubScope("reduction_indices"), []int32{0}))
+	}
+	paramDefs = []ParamDef{
+		ParamDef{Name: "weight", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+		ParamDef{Name: "bias", Init: tfutils.Zero(tf.Float, tf.ScalarShape())},
+	}
+	return
+}
+
+// optimizerGoLoss is the loss of makeOptimizerLoss computed in Go.
+func optimizerGoLoss(params []*tf.Tensor) (loss float32, err error) {
+	weight := params[0].Value().(float32)
+	bias := params[1].Value().(float32)
+	for i, x := range []float32{0, -1, -2, -3} {
+		diff := float32(i+1) - (bias + x*weight)
+		loss += diff * diff
+	}
+	return
+}
+
+func makeSeedOptimizer(t *testing.T) Checkpointer {
+	sm, ts := newTestSeedSM(t)
+	return NewSeedOptimizer(&sm, ts.bestSeed)
+}
+
+func makeWeightedSeedOptimizer(t *testing.T) Checkpointer {
+	sm, ts := newTestWeightedSeedSM(t)
+	return NewWeightedSeedOptimizer(&sm, ts.seedWeights)
+}
+
+// trainOptimizer knows nothing about which state machine it is training.
+func trainOptimizer(t *testing.T, opt Optimizer, generations int) {
+	for i := 0; i < generations; i++ {
+		err := opt.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if opt.Generation() != int64(generations) {
+		t.Fatal("generation is", opt.Generation(), "not", generations)
+	}
+	paramTensors, err := opt.Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []interface{}{}
+	for _, tensor := range paramTensors {
+		values = append(values, tensor.Value())
+	}
+	checkFitted(t, values)
+}
+
+func TestOptimizers(t *testing.T) {
+	seedOpt := makeSeedOptimizer(t)
+	defer seedOpt.Close()
+	trainOptimizer(t, seedOpt, 500)
+	weightedOpt := makeWeightedSeedOptimizer(t)
+	defer weightedOpt.Close()
+	trainOptimizer(t, weightedOpt, 1000)
+}
+
+func TestCheckpointerOptimizer(t *testing.T) {
+	for _, makeOpt := range []func(*testing.T) Checkpointer{makeSeedOptimizer, makeWeightedSeedOptimizer} {
+		opt1 := makeOpt(t)
+		opt2 := makeOpt(t)
+		for i := 0; i < 10; i++ {
+			err := opt1.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		buf := &bytes.Buffer{}
+		err := opt1.Save(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = opt2.Load(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opt2.Generation() != opt1.Generation() {
+			t.Fatal("generations are different", opt1.Generation(), opt2.Generation())
+		}
+		params1, err := opt1.Params()
+		if err != nil {
+			t.Fatal(err)
+		}
+		params2, err := opt2.Params()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range params1 {
+			if !reflect.DeepEqual(params1[i].Value(), params2[i].Value()) {
+				t.Fatal("params are different")
+			}
+		}
+		opt1.Close()
+		opt2.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package descend
+
+import (
+	"errors"
+	"sync"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Parallel evaluation splits the seeds between several sessions on the same graph, and runs each in its own goroutine.
+// This can use all the cores when TF's intra-op parallelism can not, and each session can be given its own thread settings.
+// Variables are not shared between sessions, so the params, generation and sigma are read from the session of the state machine and fed to the others.
+// Anything else which the loss needs, such as data, must be initialized in each of the sessions by the user.
+
+// makeParallelEvaluate makes a func which evaluates the seeds split between sessions, and merges their fitness, and behaviors if graph has them.
+func makeParallelEvaluate(sess *tf.Session, sessions []*tf.Session, graph FitnessGraph) func([]int) ([]float32, [][]float32, error) {
+	state := append([]tf.Output{graph.generation, graph.sigma}, graph.params...)
+	return func(seeds []int) (fitness []float32, behaviors [][]float32, err error) {
+		if len(sessions) == 0 {
+			err = errors.New("descend: no sessions to evaluate the seeds in")
+			return
+		}
+		stateTensors, err := sess.Run(nil, state, nil)
+		if err != nil {
+			return
+		}
+		feeds := map[tf.Output]*tf.Tensor{}
+		for i, output := range state {
+			feeds[output] = stateTensors[i]
+		}
+		// give each session a contiguous share of the seeds, so that only the last chunk of each needs padding.
+		shareSize := (len(seeds) + len(sessions) - 1) / len(sessions)
+		shares := make([][]float32, len(sessions))
+		behaviorShares := make([][][]float32, len(sessions))
+		errs := make([]error, len(sessions))
+		wg := sync.WaitGroup{}
+		for i, session := range sessions {
+			start := i * shareSize
+			end := start + shareSize
+			if end > len(seeds) {
+				end = len(seeds)
+			}
+			if start >= end {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, session *tf.Session, share []int) {
+				defer wg.Done()
+				shares[i], behaviorShares[i], errs[i] = evaluateBehaviors(session, graph, feeds, share)
+			}(i, session, seeds[start:end])
+		}
+		wg.Wait()
+		fitness = make([]float32, 0, len(seeds))
+		for i, share := range shares {
+			if errs[i] != nil {
+				err = errs[i]
+				return
+			}
+			fitness = append(fitness, share...)
+			behaviors = append(behaviors, behaviorShares[i]...)
+		}
+		return
+	}
+}
+
+// MakeParallelBestSeed makes a func which returns the best seed, as the bestSeed func of a SeedSM does, but evaluates the seeds split between sessions.
+// sess is the session of the state machine, and graph must have been filled in by newBestSeed using ExportFitnessGraph.
+func MakeParallelBestSeed(sess *tf.Session, sessions []*tf.Session, graph FitnessGraph) func() (int64, error) {
+	evaluate := makeParallelEvaluate(sess, sessions, graph)
+	return func() (seed int64, err error) {
+		fitness, _, err := evaluate(seedRange(graph.numSeeds))
+		if err != nil {
+			return
+		}
+		seed = fittestSeed(fitness)
+		return
+	}
+}
+
+// MakeParallelSeedWeights makes a func which returns the seed weights, as the seedWeights func of a WeightedSeedSM does, but evaluates the seeds split between sessions.
+// sess is the session of the state machine, and graph must have been filled in by newSeedWeights using ExportFitnessGraph.
+// The weights are calculated from the merged fitness in sess.
+func MakeParallelSeedWeights(sess *tf.Session, sessions []*tf.Session, graph FitnessGraph) func() ([]float32, error) {
+	evaluate := makeParallelEvaluate(sess, sessions, graph)
+	_, weigh := MakeFitnessFuncs(sess, graph)
+	return func() (weights []float32, err error) {
+		fitness, _, err := evaluate(seedRange(graph.numSeeds))
+		if err != nil {
+			return
+		}
+		return weigh(fitness)
+	}
+}
@@ -0,0 +1,114 @@
+package descend
+
+import (
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// makeSessions makes n sessions on graph. Nothing is initialized in them.
+func makeSessions(t *testing.T, graph *tf.Graph, n int) (sessions []*tf.Session) {
+	for i := 0; i < n; i++ {
+		sess, err := tf.NewSession(graph, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return
+}
+
+func testParallelBestSeed(t *testing.T, options ...SMOption) {
+	s := op.NewScope()
+	lossFunc, paramDefs := makeOptimizerLoss(s)
+	makeSM, newBestSeed, _, _ := NewSeedSM(s.SubScope("sm"), MakeNoise(0.003), paramDefs, 7, options...)
+	fitnessGraph := FitnessGraph{}
+	makeBestSeed := newBestSeed(lossFunc, ExportFitnessGraph(&fitnessGraph))
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := makeSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bestSeed, err := makeBestSeed(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallelBestSeed := MakeParallelBestSeed(sess, makeSessions(t, graph, 3), fitnessGraph)
+	for i := 0; i < 10; i++ { // the params move, so the other sessions must be fed the new ones each time.
+		seed, err := bestSeed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parallelSeed, err := parallelBestSeed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed != parallelSeed {
+			t.Fatal("best seeds are different", seed, parallelSeed)
+		}
+		err = sm.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testParallelSeedWeights(t *testing.T, options ...SMOption) {
+	s := op.NewScope()
+	lossFunc, paramDefs := makeOptimizerLoss(s)
+	makeSM, newSeedWeights, _, _ := NewWeightedSeedSM(s.SubScope("sm"), MakeNoise(0.003), paramDefs, 7, options...)
+	fitnessGraph := FitnessGraph{}
+	makeSeedWeights := newSeedWeights(lossFunc, op.Const(s.SubScope("seed_weight"), float32(100)), ExportFitnessGraph(&fitnessGraph))
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := makeSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedWeights, err := makeSeedWeights(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallelSeedWeights := MakeParallelSeedWeights(sess, makeSessions(t, graph, 3), fitnessGraph)
+	for i := 0; i < 10; i++ {
+		weights, err := seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parallelWeights, err := parallelSeedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !paramsClose(weights, parallelWeights) {
+			t.Fatal("weights are different", weights, parallelWeights)
+		}
+		err = sm.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParallelEval(t *testing.T) {
+	testParallelBestSeed(t)
+	testParallelSeedWeights(t)
+}
+
+func TestParallelChunkedEval(t *testing.T) {
+	testParallelBestSeed(t, ChunkedEval(2))
+	testParallelSeedWeights(t, ChunkedEval(2))
+}
@@ -0,0 +1,352 @@
+package descend
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/is8ac/tfutils/tb"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// Hyperparams are the hyperparameters of a member of a PBT population which can change while it trains.
+type Hyperparams struct {
+	Sigma      float32 // scales the noise, as set by SetSigma.
+	SeedWeight float32 // the seed weight given to newSeedWeights, which acts as the learning rate.
+}
+
+// NewSeedWeight makes a seed weight, to give to newSeedWeights, which is kept in a variable so that PBT can change it.
+// makeSetSeedWeight initializes it to initial, and returns a func to set it. Make each seed weight in its own SubScope.
+func NewSeedWeight(s *op.Scope, initial float32) (seedWeight tf.Output, makeSetSeedWeight func(*tf.Session) (func(float32) error, error)) {
+	ns := namespace(s, "NewSeedWeight", nil)
+	handle := op.VarHandleOp(s, tf.Float, tf.ScalarShape(), op.VarHandleOpSharedName(sharedName(ns, "seed_weight")))
+	ph := op.Placeholder(s.SubScope("ph"), tf.Float, op.PlaceholderShape(tf.ScalarShape()))
+	update := op.AssignVariableOp(s.SubScope("set"), handle, ph)
+	init := op.AssignVariableOp(s.SubScope("init"), handle, op.Const(s.SubScope("initial"), initial))
+	seedWeight = op.ReadVariableOp(s, handle, tf.Float)
+	makeSetSeedWeight = func(sess *tf.Session) (setSeedWeight func(float32) error, err error) {
+		_, err = sess.Run(nil, nil, []*tf.Operation{init})
+		if err != nil {
+			return
+		}
+		setSeedWeight = func(weight float32) (err error) {
+			weightTensor, err := tf.NewTensor(weight)
+			if err != nil {
+				return
+			}
+			_, err = sess.Run(map[tf.Output]*tf.Tensor{ph: weightTensor}, nil, []*tf.Operation{update})
+			return
+		}
+		return
+	}
+	return
+}
+
+// varCopier sets variables to values read from another session, whose graph was built the same way.
+type varCopier struct {
+	values []tf.Output // the values of the variables, to be read from the other session.
+	phs    []tf.Output
+	assign []*tf.Operation
+}
+
+// makeVarCopier makes the ops to set each of handles to a value fed to a placeholder. values are their current values.
+func makeVarCopier(s *op.Scope, handles, values []tf.Output) (c varCopier) {
+	c.values = values
+	for i, handle := range handles {
+		varScope := s.SubScope("var_" + strconv.Itoa(i))
+		ph := op.Placeholder(varScope, values[i].DataType())
+		c.phs = append(c.phs, ph)
+		c.assign = append(c.assign, op.AssignVariableOp(varScope, handle, ph))
+	}
+	return
+}
+
+// copyFrom sets the params, moving averages, lineage and sigma of sm to those of src, which must be made from the same param defs, noise and number of seeds.
+// The variables are read from the session of src and assigned directly, rather than replaying the lineage.
+// Update rules with state do not expose their variables, so with one the lineage is replayed instead.
+func (sm *WeightedSeedSM) copyFrom(src *WeightedSeedSM) (err error) {
+	seedWeights := append([][]float32{}, src.SeedWeights...)
+	sigmas := append([]float32{}, src.Sigmas...)
+	if sm.replayRewind {
+		return sm.replay(seedWeights, sigmas, src.Sigma)
+	}
+	if len(sm.copier.phs) != len(src.copier.values) || sm.numSeeds != src.numSeeds {
+		return errors.New("descend: PBT members must be made from the same param defs and number of seeds")
+	}
+	values, err := src.sess.Run(nil, src.copier.values, nil)
+	if err != nil {
+		return
+	}
+	feeds := map[tf.Output]*tf.Tensor{}
+	for i, ph := range sm.copier.phs {
+		feeds[ph] = values[i]
+	}
+	_, err = sm.sess.Run(feeds, nil, sm.copier.assign)
+	if err != nil {
+		return
+	}
+	sm.Generation = src.Generation
+	sm.SeedWeights = seedWeights
+	sm.Sigmas = sigmas
+	sm.ema.undoable = false // the previous averages are still those of sm, so a rewind must replay.
+	err = setGeneration(sm.sess, sm.genPH, sm.updateGeneration, sm.Generation)
+	if err != nil {
+		return
+	}
+	err = sm.SetSigma(src.Sigma)
+	return
+}
+
+// PBTMember is one member of a PBT population. Each member has its own graph and session, so they can step in parallel.
+type PBTMember struct {
+	SM            *WeightedSeedSM
+	SeedWeights   func() ([]float32, error)
+	Eval          func() (float32, error) // returns the metric by which members are compared.
+	SetSeedWeight func(float32) error     // if nil, the seed weight is not explored.
+	Close         func() error            // closes the session of the member. Optional.
+}
+
+// PBT trains a population of WeightedSeedSMs, and every so often copies the params of the best members into the worst (exploit), and perturbs their hyperparameters (explore).
+// The params of members are copied directly between their sessions, so they must all have the same param defs, noise func and number of seeds.
+// Only Make, Initial, Size, Generations and Interval are needed, the rest are optional.
+type PBT struct {
+	// Make builds the member with the given index and hyperparams. logDir is its own TensorBoard run directory, in which it may log whatever it likes.
+	Make        func(member int, hyperparams Hyperparams, logDir string) (PBTMember, error)
+	Initial     func(member int) Hyperparams // the hyperparams with which each member starts.
+	Size        int                          // how many members.
+	Generations int64                        // train until each member is at this generation.
+	Interval    int64                        // evaluate, exploit and explore every this many generations.
+	Maximize    bool                         // higher values of the metric are better, as for accuracy.
+	Truncation  float32                      // the fraction of the members which are replaced by copies of the best. The default is 0.25, or 1 member if that is more.
+	Perturb     float32                      // explore multiplies each hyperparam by 1+Perturb or 1-Perturb. The default is 0.2.
+	LogDir      string                       // each member logs to LogDir/member_i. Empty means no logs.
+	Rand        *rand.Rand                   // chooses the sources of copies and the perturbations. The default is seeded with 0.
+	// OnRound is called after each round of evaluation, before exploiting and exploring.
+	OnRound func(generation int64, metrics []float32, hyperparams []Hyperparams) error
+}
+
+// PBTResult is what PBT found.
+type PBTResult struct {
+	Best        int           // the index of the member with the best final metric.
+	Metrics     []float32     // the final metric of each member.
+	Hyperparams []Hyperparams // the final hyperparams of each member.
+}
+
+// pbtMember is the state which PBT keeps for each member.
+type pbtMember struct {
+	PBTMember
+	hyperparams Hyperparams
+	metric      float32
+	log         *tb.ScalarWriter
+}
+
+// better returns true if a is better than b.
+func (p *PBT) better(a, b float32) bool {
+	if p.Maximize {
+		return a > b
+	}
+	return a < b
+}
+
+// Train makes the members, and trains them until they reach Generations.
+func (p *PBT) Train() (result PBTResult, err error) {
+	if p.Size < 2 || p.Interval < 1 {
+		err = errors.New("descend: PBT needs at least 2 members and an interval of at least 1")
+		return
+	}
+	rng := p.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(0))
+	}
+	members := make([]*pbtMember, p.Size)
+	defer func() {
+		for _, m := range members {
+			if m == nil {
+				continue
+			}
+			if m.log != nil {
+				m.log.Close()
+			}
+			if m.Close != nil {
+				m.Close()
+			}
+		}
+	}()
+	for i := range members {
+		hyperparams := p.Initial(i)
+		var logDir string
+		if p.LogDir != "" {
+			logDir = filepath.Join(p.LogDir, "member_"+strconv.Itoa(i))
+		}
+		var member PBTMember
+		member, err = p.Make(i, hyperparams, logDir)
+		if err != nil {
+			return
+		}
+		members[i] = &pbtMember{PBTMember: member}
+		if logDir != "" {
+			var log tb.ScalarWriter
+			log, err = tb.NewScalarWriter(logDir)
+			if err != nil {
+				return
+			}
+			members[i].log = &log
+		}
+		err = members[i].setHyperparams(hyperparams)
+		if err != nil {
+			return
+		}
+	}
+	for generation := int64(0); generation < p.Generations; {
+		generation += p.Interval
+		if generation > p.Generations {
+			generation = p.Generations
+		}
+		err = p.round(members, generation)
+		if err != nil {
+			return
+		}
+		if generation == p.Generations {
+			break
+		}
+		err = p.exploitAndExplore(members, rng)
+		if err != nil {
+			return
+		}
+	}
+	for i, m := range members {
+		result.Metrics = append(result.Metrics, m.metric)
+		result.Hyperparams = append(result.Hyperparams, m.hyperparams)
+		if p.better(m.metric, members[result.Best].metric) {
+			result.Best = i
+		}
+	}
+	return
+}
+
+// round steps every member in parallel until it reaches generation, then evaluates and logs them.
+func (p *PBT) round(members []*pbtMember, generation int64) (err error) {
+	errs := make([]error, len(members))
+	wg := sync.WaitGroup{}
+	for i, m := range members {
+		wg.Add(1)
+		go func(i int, m *pbtMember) {
+			defer wg.Done()
+			errs[i] = m.train(generation)
+		}(i, m)
+	}
+	wg.Wait()
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+	if p.OnRound != nil {
+		metrics := make([]float32, len(members))
+		hyperparams := make([]Hyperparams, len(members))
+		for i, m := range members {
+			metrics[i] = m.metric
+			hyperparams[i] = m.hyperparams
+		}
+		err = p.OnRound(generation, metrics, hyperparams)
+	}
+	return
+}
+
+// train steps the member until it reaches generation, then evaluates and logs it.
+func (m *pbtMember) train(generation int64) (err error) {
+	for m.SM.Generation < generation {
+		var weights []float32
+		weights, err = m.SeedWeights()
+		if err != nil {
+			return
+		}
+		err = m.SM.Step(weights)
+		if err != nil {
+			return
+		}
+	}
+	m.metric, err = m.Eval()
+	if err != nil || m.log == nil {
+		return
+	}
+	for _, scalar := range []struct {
+		tag   string
+		value float32
+	}{
+		{"pbt/metric", m.metric},
+		{"pbt/sigma", m.hyperparams.Sigma},
+		{"pbt/seed_weight", m.hyperparams.SeedWeight},
+	} {
+		err = m.log.Write(scalar.tag, generation, scalar.value)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// setHyperparams sets the sigma and seed weight of the member.
+func (m *pbtMember) setHyperparams(hyperparams Hyperparams) (err error) {
+	err = m.SM.SetSigma(hyperparams.Sigma)
+	if err != nil {
+		return
+	}
+	if m.SetSeedWeight != nil {
+		err = m.SetSeedWeight(hyperparams.SeedWeight)
+		if err != nil {
+			return
+		}
+	}
+	m.hyperparams = hyperparams
+	return
+}
+
+// exploitAndExplore replaces each of the worst members with a copy of one of the best, with perturbed hyperparams.
+func (p *PBT) exploitAndExplore(members []*pbtMember, rng *rand.Rand) (err error) {
+	truncation := p.Truncation
+	if truncation == 0 {
+		truncation = 0.25
+	}
+	perturb := p.Perturb
+	if perturb == 0 {
+		perturb = 0.2
+	}
+	n := int(truncation * float32(len(members)))
+	if n < 1 {
+		n = 1
+	}
+	if n > len(members)/2 {
+		n = len(members) / 2
+	}
+	ranked := make([]*pbtMember, len(members))
+	copy(ranked, members)
+	sort.SliceStable(ranked, func(i, j int) bool { return p.better(ranked[i].metric, ranked[j].metric) })
+	// explore returns value multiplied by 1+perturb or 1-perturb.
+	explore := func(value float32) float32 {
+		if rng.Intn(2) == 0 {
+			return value * (1 + perturb)
+		}
+		return value * (1 - perturb)
+	}
+	for _, worst := range ranked[len(ranked)-n:] {
+		best := ranked[rng.Intn(n)]
+		err = worst.SM.copyFrom(best.SM)
+		if err != nil {
+			return
+		}
+		worst.metric = best.metric
+		err = worst.setHyperparams(Hyperparams{
+			Sigma:      explore(best.hyperparams.Sigma),
+			SeedWeight: explore(best.hyperparams.SeedWeight),
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
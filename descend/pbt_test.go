@@ -0,0 +1,122 @@
+package descend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func makePBTMember(t *testing.T, hyperparams Hyperparams) (m PBTMember) {
+	var makeSetSeedWeight func(*tf.Session) (func(float32) error, error)
+	sm, ts := newTestWeightedSeedSM(t, withSeedWeight(func(s *op.Scope) (seedWeight tf.Output) {
+		seedWeight, makeSetSeedWeight = NewSeedWeight(s, hyperparams.SeedWeight)
+		return
+	}))
+	m = PBTMember{SM: &sm, SeedWeights: ts.seedWeights, Close: ts.sess.Close}
+	var err error
+	m.SetSeedWeight, err = makeSetSeedWeight(ts.sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Eval = func() (metric float32, err error) {
+		results, err := ts.sess.Run(nil, []tf.Output{ts.loss}, nil)
+		if err != nil {
+			return
+		}
+		metric = results[0].Value().(float32)
+		return
+	}
+	return
+}
+
+func TestPBT(t *testing.T) {
+	logDir := t.TempDir()
+	rounds := 0
+	pbt := PBT{
+		Make: func(member int, hyperparams Hyperparams, logDir string) (PBTMember, error) {
+			return makePBTMember(t, hyperparams), nil
+		},
+		Initial: func(member int) Hyperparams {
+			return Hyperparams{Sigma: 1, SeedWeight: []float32{0, 1, 10, 100}[member]} // the first member never moves.
+		},
+		Size:        4,
+		Generations: 30,
+		Interval:    10,
+		LogDir:      logDir,
+		OnRound: func(generation int64, metrics []float32, hyperparams []Hyperparams) error {
+			rounds++
+			return nil
+		},
+	}
+	result, err := pbt.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rounds != 3 {
+		t.Fatal("there were", rounds, "rounds")
+	}
+	// the member which never moves is the worst, so it should have been replaced by a copy of a better one.
+	if result.Hyperparams[0].SeedWeight == 0 {
+		t.Fatal("the worst member was not replaced")
+	}
+	if result.Metrics[0] >= 30 {
+		t.Fatal("the copy of the best member did not learn", result.Metrics)
+	}
+	for i := range result.Metrics {
+		if pbt.better(result.Metrics[i], result.Metrics[result.Best]) {
+			t.Fatal("member", i, "is better than the best", result.Metrics)
+		}
+		entries, err := os.ReadDir(filepath.Join(logDir, "member_"+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			t.Fatal("member", i, "did not log")
+		}
+	}
+}
+
+func TestPBTCopy(t *testing.T) {
+	src := makePBTMember(t, Hyperparams{Sigma: 1, SeedWeight: 100})
+	dst := makePBTMember(t, Hyperparams{Sigma: 1, SeedWeight: 100})
+	err := dst.SM.Step([]float32{1, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = src.SM.Step([]float32{0, float32(i), 1, 0, -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = src.SM.SetSigma(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dst.SM.copyFrom(src.SM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.SM.Generation != 3 || dst.SM.Sigma != 0.5 || !reflect.DeepEqual(dst.SM.SeedWeights, src.SM.SeedWeights) {
+		t.Fatal("lineage was not copied", dst.SM.Generation, dst.SM.Sigma)
+	}
+	if !reflect.DeepEqual(readParams(t, dst.SM.sess, dst.SM.params), readParams(t, src.SM.sess, src.SM.params)) {
+		t.Fatal("params were not copied")
+	}
+	// the copied params must be those of the copied lineage, so a checkpoint of them loads.
+	buf := bytes.Buffer{}
+	err = dst.SM.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.SM.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,343 @@
+package descend
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// BehaviorFunc takes a slice of params and returns a vector which describes how they behave, for example where a robot ends up.
+// Params which behave alike should have behaviors which are close.
+type BehaviorFunc func(s *op.Scope, params []tf.Output) (behavior tf.Output)
+
+// WithBehavior makes newBestSeed also build the behavior of the params perturbed by each seed, for NoveltySearch and MAPElites.
+func WithBehavior(behavior BehaviorFunc) SeedWeightsOption {
+	return func(c *seedWeightsConfig) {
+		c.behavior = behavior
+	}
+}
+
+// evaluateBehaviors evaluates the fitness and behavior of the seeds in sess, with feeds.
+// If graph has no behaviors, behaviors is nil.
+func evaluateBehaviors(sess *tf.Session, graph FitnessGraph, feeds map[tf.Output]*tf.Tensor, seeds []int) (fitness []float32, behaviors [][]float32, err error) {
+	if graph.ChunkBehavior.Op == nil && graph.SeedBehavior == nil {
+		fitness, err = evaluateSeeds(sess, graph, feeds, seeds)
+		return
+	}
+	for _, seed := range seeds {
+		if seed < 0 || seed >= graph.numSeeds {
+			err = fmt.Errorf("descend: seed %d is out of range for %d seeds", seed, graph.numSeeds)
+			return
+		}
+	}
+	if graph.chunkSize > 0 {
+		err = runChunks(sess, feeds, graph.SeedIndices, []tf.Output{graph.ChunkFitness, graph.ChunkBehavior}, graph.chunkSize, seeds, func(_ map[tf.Output]*tf.Tensor, results []*tf.Tensor) error {
+			fitness = append(fitness, results[0].Value().([]float32)...)
+			behaviors = append(behaviors, results[1].Value().([][]float32)...)
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		fitness = fitness[:len(seeds)]
+		behaviors = behaviors[:len(seeds)]
+		return
+	}
+	fetches := make([]tf.Output, 0, len(seeds)*2)
+	for _, seed := range seeds {
+		fetches = append(fetches, graph.SeedFitness[seed], graph.SeedBehavior[seed])
+	}
+	results, err := sess.Run(feeds, fetches, nil)
+	if err != nil {
+		return
+	}
+	fitness = make([]float32, len(seeds))
+	behaviors = make([][]float32, len(seeds))
+	for i := range seeds {
+		fitness[i] = results[i*2].Value().(float32)
+		behaviors[i] = results[i*2+1].Value().([]float32)
+	}
+	return
+}
+
+// behaviorDistance is the euclidean distance between two behaviors.
+func behaviorDistance(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		diff := float64(a[i] - b[i])
+		sum += diff * diff
+	}
+	return float32(math.Sqrt(sum))
+}
+
+// NoveltySearch searches for params which behave differently from those it has seen, ignoring the loss.
+// Each generation, the most novel individuals are the parents, and the most novel children are added to the archive.
+// The novelty of an individual is its mean distance to its nearest neighbors in the archive and the population.
+// It steps and resets the SeedSM itself; use Materialize to set the params to those of any individual.
+type NoveltySearch struct {
+	Generation int64
+	Population []Individual // sorted with the most novel first.
+	Novelty    []float32    // the novelty of each of Population.
+	Archive    []Individual
+	Best       Individual // the fittest individual seen so far.
+	breeder
+	config gaConfig
+}
+
+// WithNeighbors sets how many nearest neighbors the novelty of an individual is measured against. The default is 10.
+func WithNeighbors(k int) GAOption {
+	return func(c *gaConfig) {
+		c.neighbors = k
+	}
+}
+
+// WithArchiveRate sets how many of the most novel children are added to the archive each generation. The default is 1.
+func WithArchiveRate(n int) GAOption {
+	return func(c *gaConfig) {
+		c.archiveRate = n
+	}
+}
+
+// NewNoveltySearch makes a NoveltySearch with popSize individuals, each of which is the initial params mutated by one seed.
+// graph must have been filled in by the newBestSeed of sm using ExportFitnessGraph and WithBehavior; mutations are drawn from its seeds.
+// Of the GAOptions, elites are the most novel rather than the fittest.
+func NewNoveltySearch(sm *SeedSM, graph FitnessGraph, popSize int, options ...GAOption) (ns NoveltySearch, err error) {
+	config := makeGAConfig(popSize, options)
+	if graph.ChunkBehavior.Op == nil && graph.SeedBehavior == nil {
+		err = errors.New("descend: novelty search needs a graph built with WithBehavior")
+		return
+	}
+	if popSize < 1 || config.elites >= popSize {
+		err = errors.New("descend: the population must be bigger than the number of elites")
+		return
+	}
+	ns = NoveltySearch{config: config}
+	ns.breeder, err = newBreeder(sm, graph, config)
+	if err != nil {
+		return
+	}
+	population, err := ns.mutate([]Individual{Individual{}}, make([]int, popSize))
+	if err != nil {
+		return
+	}
+	err = ns.nextGeneration(population)
+	return
+}
+
+// Step makes the next generation from the most novel of this one, and leaves the params of sm at Best.
+func (ns *NoveltySearch) Step() (err error) {
+	truncation := ns.config.truncation
+	if truncation > len(ns.Population) {
+		truncation = len(ns.Population)
+	}
+	children, err := ns.mutate(ns.Population[:truncation], ns.chooseParents(truncation, len(ns.Population)-ns.config.elites))
+	if err != nil {
+		return
+	}
+	err = ns.nextGeneration(append(ns.Population[:ns.config.elites:ns.config.elites], children...))
+	if err != nil {
+		return
+	}
+	ns.Generation++
+	return
+}
+
+// nextGeneration measures the novelty of population, archives the most novel, and makes it the population.
+func (ns *NoveltySearch) nextGeneration(population []Individual) (err error) {
+	novelty := make([]float32, len(population))
+	for i, individual := range population {
+		distances := make([]float32, 0, len(population)+len(ns.Archive))
+		for j, other := range population {
+			if j != i {
+				distances = append(distances, behaviorDistance(individual.Behavior, other.Behavior))
+			}
+		}
+		for _, other := range ns.Archive {
+			distances = append(distances, behaviorDistance(individual.Behavior, other.Behavior))
+		}
+		sort.Slice(distances, func(a, b int) bool { return distances[a] < distances[b] })
+		if len(distances) > ns.config.neighbors {
+			distances = distances[:ns.config.neighbors]
+		}
+		for _, distance := range distances {
+			novelty[i] += distance / float32(len(distances))
+		}
+		if ns.Best.Seeds == nil || individual.Fitness > ns.Best.Fitness {
+			ns.Best = individual
+		}
+	}
+	order := make([]int, len(population))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return novelty[order[a]] > novelty[order[b]] })
+	ns.Population = make([]Individual, len(population))
+	ns.Novelty = make([]float32, len(population))
+	for i, index := range order {
+		ns.Population[i] = population[index]
+		ns.Novelty[i] = novelty[index]
+	}
+	for i := 0; i < ns.config.archiveRate && i < len(ns.Population); i++ {
+		ns.Archive = append(ns.Archive, ns.Population[i])
+	}
+	err = ns.Materialize(ns.Best)
+	return
+}
+
+// Grid divides the space of behaviors into cells for MAPElites.
+type Grid struct {
+	Min, Max []float32 // the bounds of each dimension of the behaviors. Behaviors outside them go in the edge cells.
+	Bins     []int     // how many cells each dimension is divided into.
+}
+
+// cell returns the index of each dimension of the cell which behavior falls in.
+func (g Grid) cell(behavior []float32) (cell []int, err error) {
+	if len(behavior) != len(g.Bins) {
+		err = fmt.Errorf("descend: behavior has %d dimensions but grid has %d", len(behavior), len(g.Bins))
+		return
+	}
+	cell = make([]int, len(g.Bins))
+	for i, value := range behavior {
+		bin := int(float32(g.Bins[i]) * (value - g.Min[i]) / (g.Max[i] - g.Min[i]))
+		if bin < 0 {
+			bin = 0
+		}
+		if bin >= g.Bins[i] {
+			bin = g.Bins[i] - 1
+		}
+		cell[i] = bin
+	}
+	return
+}
+
+// flatten returns the index of the cell in a flat array of all the cells.
+func (g Grid) flatten(cell []int) (index int) {
+	for i, bin := range cell {
+		index = index*g.Bins[i] + bin
+	}
+	return
+}
+
+// MAPElites keeps the fittest individual found in each cell of a grid over the behaviors.
+// Each generation, a batch of elites chosen uniformly are mutated, and each child replaces the elite of its cell if it is fitter.
+// It steps and resets the SeedSM itself; use Materialize to set the params to those of any elite.
+type MAPElites struct {
+	Generation int64
+	Grid       Grid
+	elites     map[int]Individual // keyed by flattened cell.
+	batchSize  int
+	breeder
+}
+
+// NewMAPElites makes a MAPElites with the elites of batchSize children of the initial params.
+// graph must have been filled in by the newBestSeed of sm using ExportFitnessGraph and WithBehavior; mutations are drawn from its seeds.
+// Of the GAOptions, only WithGARand and WithGASessions are used.
+func NewMAPElites(sm *SeedSM, graph FitnessGraph, grid Grid, batchSize int, options ...GAOption) (me MAPElites, err error) {
+	config := makeGAConfig(batchSize, options)
+	if graph.ChunkBehavior.Op == nil && graph.SeedBehavior == nil {
+		err = errors.New("descend: MAP-Elites needs a graph built with WithBehavior")
+		return
+	}
+	if len(grid.Min) != len(grid.Bins) || len(grid.Max) != len(grid.Bins) {
+		err = errors.New("descend: grid must have a min, max and number of bins for each dimension")
+		return
+	}
+	for i, bins := range grid.Bins {
+		if bins < 1 {
+			err = fmt.Errorf("descend: dimension %d of the grid has %d bins, it needs at least 1", i, bins)
+			return
+		}
+		if !(grid.Max[i] > grid.Min[i]) {
+			err = fmt.Errorf("descend: dimension %d of the grid has a max of %v, which is not more than its min of %v", i, grid.Max[i], grid.Min[i])
+			return
+		}
+	}
+	if batchSize < 1 {
+		err = errors.New("descend: the batch size must be at least 1")
+		return
+	}
+	me = MAPElites{Grid: grid, elites: map[int]Individual{}, batchSize: batchSize}
+	me.breeder, err = newBreeder(sm, graph, config)
+	if err != nil {
+		return
+	}
+	children, err := me.mutate([]Individual{Individual{}}, make([]int, batchSize))
+	if err != nil {
+		return
+	}
+	err = me.insert(children)
+	return
+}
+
+// Step mutates a batch of elites, and keeps the children which are fitter than the elites of their cells.
+func (me *MAPElites) Step() (err error) {
+	parents := me.Elites()
+	children, err := me.mutate(parents, me.chooseParents(len(parents), me.batchSize))
+	if err != nil {
+		return
+	}
+	err = me.insert(children)
+	if err != nil {
+		return
+	}
+	me.Generation++
+	return
+}
+
+// insert puts each of the individuals in its cell if it is empty or has a less fit elite.
+func (me *MAPElites) insert(individuals []Individual) (err error) {
+	for _, individual := range individuals {
+		var cell []int
+		cell, err = me.Grid.cell(individual.Behavior)
+		if err != nil {
+			return
+		}
+		index := me.Grid.flatten(cell)
+		elite, ok := me.elites[index]
+		if !ok || individual.Fitness > elite.Fitness {
+			me.elites[index] = individual
+		}
+	}
+	return
+}
+
+// Elites returns the elite of each filled cell, in the order of the cells.
+func (me *MAPElites) Elites() (elites []Individual) {
+	indices := make([]int, 0, len(me.elites))
+	for index := range me.elites {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		elites = append(elites, me.elites[index])
+	}
+	return
+}
+
+// Elite returns the elite of the cell, which has one index for each dimension of the grid, and whether the cell has been filled.
+// A cell outside of the grid has never been filled.
+func (me *MAPElites) Elite(cell []int) (elite Individual, ok bool) {
+	if len(cell) != len(me.Grid.Bins) {
+		return
+	}
+	for i, index := range cell {
+		if index < 0 || index >= me.Grid.Bins[i] {
+			return
+		}
+	}
+	elite, ok = me.elites[me.Grid.flatten(cell)]
+	return
+}
+
+// Coverage returns the fraction of the cells which have been filled.
+func (me *MAPElites) Coverage() float32 {
+	numCells := 1
+	for _, bins := range me.Grid.Bins {
+		numCells *= bins
+	}
+	return float32(len(me.elites)) / float32(numCells)
+}
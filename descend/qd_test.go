@@ -0,0 +1,146 @@
+package descend
+
+import (
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// makeQDSM makes a SeedSM on the optimizer loss, with the params themselves as the behavior.
+func makeQDSM(t *testing.T, options ...SMOption) (sm SeedSM, ts testSM) {
+	return newTestSeedSM(t, withNoise(MakeNoise(0.3)), withNumSeeds(100), withSMOptions(options...), withEvalOptions(WithBehavior(func(s *op.Scope, params []tf.Output) tf.Output {
+		return op.Pack(s, params)
+	})))
+}
+
+// checkMaterialized checks that the params are the behavior of the individual.
+func checkMaterialized(t *testing.T, sess *tf.Session, params []tf.Output, individual Individual) {
+	values := readParams(t, sess, params)
+	if !paramsClose(values, individual.Behavior) {
+		t.Fatal("params", values, "are not the behavior", individual.Behavior)
+	}
+}
+
+func TestNoveltySearch(t *testing.T) {
+	sm, ts := makeQDSM(t)
+	ns, err := NewNoveltySearch(&sm, ts.fitness, 20, WithTruncation(4), WithNeighbors(5), WithArchiveRate(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err = ns.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ns.Archive) != 22 {
+		t.Fatal("archive has", len(ns.Archive), "individuals")
+	}
+	for i := 1; i < len(ns.Novelty); i++ {
+		if ns.Novelty[i] > ns.Novelty[i-1] {
+			t.Fatal("population is not sorted by novelty", ns.Novelty)
+		}
+	}
+	checkMaterialized(t, ts.sess, ts.params, ns.Best)
+	err = ns.Materialize(ns.Archive[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMaterialized(t, ts.sess, ts.params, ns.Archive[3])
+}
+
+func TestMAPElites(t *testing.T) {
+	for _, options := range [][]SMOption{nil, []SMOption{ChunkedEval(8)}} {
+		sm, ts := makeQDSM(t, options...)
+		grid := Grid{Min: []float32{-2, -2}, Max: []float32{2, 2}, Bins: []int{8, 8}}
+		me, err := NewMAPElites(&sm, ts.fitness, grid, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		initialCoverage := me.Coverage()
+		for i := 0; i < 20; i++ {
+			err = me.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if me.Coverage() <= initialCoverage {
+			t.Fatal("coverage did not grow", initialCoverage, me.Coverage())
+		}
+		for _, elite := range me.Elites() {
+			cell, err := grid.cell(elite.Behavior)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cellElite, ok := me.Elite(cell)
+			if !ok || cellElite.Fitness != elite.Fitness {
+				t.Fatal("elite is not in its cell")
+			}
+			err = me.Materialize(elite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMaterialized(t, ts.sess, ts.params, elite)
+		}
+	}
+}
+
+// A cell outside of the grid must not alias a cell inside it.
+func TestMAPElitesEliteOutOfGrid(t *testing.T) {
+	sm, ts := makeQDSM(t)
+	grid := Grid{Min: []float32{-2, -2}, Max: []float32{2, 2}, Bins: []int{4, 4}}
+	me, err := NewMAPElites(&sm, ts.fitness, grid, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		err = me.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, elite := range me.Elites() {
+		cell, err := grid.cell(elite.Behavior)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, outside := range [][]int{{cell[0] - 4, cell[1] + 1}, {cell[0] + 1, cell[1] - 4}, {cell[0] + 4, cell[1]}, {cell[0], cell[1] + 4}, {-1, -1}} {
+			_, ok := me.Elite(outside)
+			if ok {
+				t.Fatal("cell", outside, "is outside of the grid, but has an elite")
+			}
+		}
+	}
+	_, ok := me.Elite([]int{0})
+	if ok {
+		t.Fatal("a cell with too few indices has an elite")
+	}
+}
+
+func TestQDNeedsBehavior(t *testing.T) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.3)), withNumSeeds(10))
+	_, err := NewNoveltySearch(&sm, ts.fitness, 10)
+	if err == nil {
+		t.Fatal("expected an error without a behavior")
+	}
+}
+
+func TestMAPElitesBadArgs(t *testing.T) {
+	sm, ts := makeQDSM(t)
+	good := Grid{Min: []float32{-2, -2}, Max: []float32{2, 2}, Bins: []int{4, 4}}
+	for _, test := range []struct {
+		grid      Grid
+		batchSize int
+	}{
+		{Grid{Min: []float32{-2, -2}, Max: []float32{2, 2}, Bins: []int{4, 0}}, 10},
+		{Grid{Min: []float32{-2, 2}, Max: []float32{2, 2}, Bins: []int{4, 4}}, 10},
+		{good, 0},
+		{good, -1},
+	} {
+		_, err := NewMAPElites(&sm, ts.fitness, test.grid, test.batchSize)
+		if err == nil {
+			t.Fatal("expected an error for", test.grid, test.batchSize)
+		}
+	}
+}
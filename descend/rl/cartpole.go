@@ -0,0 +1,64 @@
+package rl
+
+import (
+	"math"
+	"math/rand"
+)
+
+// CartPole is the classic task of balancing a pole on a cart, as in OpenAI Gym.
+// The action has a value for pushing left and for pushing right, and the larger wins.
+// The reward is 1 for each step until the pole falls more than 12 degrees or the cart leaves the track. Episodes are usually limited to 500 steps.
+type CartPole struct {
+	x, xDot, theta, thetaDot float64
+}
+
+// The physics of CartPole.
+const (
+	cartPoleGravity       = 9.8
+	cartPoleCartMass      = 1.0
+	cartPolePoleMass      = 0.1
+	cartPoleTotalMass     = cartPoleCartMass + cartPolePoleMass
+	cartPoleLength        = 0.5 // half the length of the pole.
+	cartPolePoleMassLen   = cartPolePoleMass * cartPoleLength
+	cartPoleForce         = 10.0
+	cartPoleTau           = 0.02 // seconds per step.
+	cartPoleThetaLimit    = 12 * 2 * math.Pi / 360
+	cartPolePositionLimit = 2.4
+)
+
+// Reset puts the cart near the middle with the pole nearly upright.
+func (c *CartPole) Reset(rng *rand.Rand) []float32 {
+	c.x = uniform(rng, -0.05, 0.05)
+	c.xDot = uniform(rng, -0.05, 0.05)
+	c.theta = uniform(rng, -0.05, 0.05)
+	c.thetaDot = uniform(rng, -0.05, 0.05)
+	return c.observation()
+}
+
+// Step pushes the cart left or right.
+func (c *CartPole) Step(action []float32) (observation []float32, reward float32, done bool) {
+	force := -cartPoleForce
+	if argmax(action) == 1 {
+		force = cartPoleForce
+	}
+	cos, sin := math.Cos(c.theta), math.Sin(c.theta)
+	temp := (force + cartPolePoleMassLen*c.thetaDot*c.thetaDot*sin) / cartPoleTotalMass
+	thetaAcc := (cartPoleGravity*sin - cos*temp) / (cartPoleLength * (4.0/3.0 - cartPolePoleMass*cos*cos/cartPoleTotalMass))
+	xAcc := temp - cartPolePoleMassLen*thetaAcc*cos/cartPoleTotalMass
+	c.x += cartPoleTau * c.xDot
+	c.xDot += cartPoleTau * xAcc
+	c.theta += cartPoleTau * c.thetaDot
+	c.thetaDot += cartPoleTau * thetaAcc
+	done = math.Abs(c.x) > cartPolePositionLimit || math.Abs(c.theta) > cartPoleThetaLimit
+	return c.observation(), 1, done
+}
+
+func (c *CartPole) observation() []float32 {
+	return []float32{float32(c.x), float32(c.xDot), float32(c.theta), float32(c.thetaDot)}
+}
+
+// ObservationSize is 4: the position and velocity of the cart, and the angle and angular velocity of the pole.
+func (c *CartPole) ObservationSize() int { return 4 }
+
+// ActionSize is 2: push left and push right.
+func (c *CartPole) ActionSize() int { return 2 }
@@ -0,0 +1,53 @@
+package rl
+
+import (
+	"math"
+	"math/rand"
+)
+
+// MountainCar is the classic task of driving an underpowered car up a hill by rocking it back and forth, as in OpenAI Gym.
+// The action has a value for pushing left, not pushing, and pushing right, and the largest wins.
+// The reward is -1 for each step until the car reaches the flag. Episodes are usually limited to 200 steps.
+type MountainCar struct {
+	position, velocity float64
+}
+
+// The physics of MountainCar.
+const (
+	mountainCarMinPosition = -1.2
+	mountainCarMaxPosition = 0.6
+	mountainCarMaxSpeed    = 0.07
+	mountainCarGoal        = 0.5
+	mountainCarForce       = 0.001
+	mountainCarGravity     = 0.0025
+)
+
+// Reset puts the car at rest near the bottom of the valley.
+func (m *MountainCar) Reset(rng *rand.Rand) []float32 {
+	m.position = uniform(rng, -0.6, -0.4)
+	m.velocity = 0
+	return m.observation()
+}
+
+// Step pushes the car left, not at all, or right.
+func (m *MountainCar) Step(action []float32) (observation []float32, reward float32, done bool) {
+	push := float64(argmax(action) - 1)
+	m.velocity += push*mountainCarForce - math.Cos(3*m.position)*mountainCarGravity
+	m.velocity = clip(m.velocity, -mountainCarMaxSpeed, mountainCarMaxSpeed)
+	m.position += m.velocity
+	m.position = clip(m.position, mountainCarMinPosition, mountainCarMaxPosition)
+	if m.position == mountainCarMinPosition && m.velocity < 0 { // the car hits the wall on the left.
+		m.velocity = 0
+	}
+	return m.observation(), -1, m.position >= mountainCarGoal
+}
+
+func (m *MountainCar) observation() []float32 {
+	return []float32{float32(m.position), float32(m.velocity)}
+}
+
+// ObservationSize is 2: the position and velocity of the car.
+func (m *MountainCar) ObservationSize() int { return 2 }
+
+// ActionSize is 3: push left, no push, and push right.
+func (m *MountainCar) ActionSize() int { return 3 }
@@ -0,0 +1,55 @@
+package rl
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Pendulum is the classic task of swinging a pendulum up and holding it upright with a weak motor, as in OpenAI Gym.
+// The action is the torque, which is clipped to between -2 and 2.
+// The reward is the negative of a cost of the angle from upright, the angular velocity and the torque. Episodes never end by themselves, and are usually limited to 200 steps.
+type Pendulum struct {
+	theta, thetaDot float64
+}
+
+// The physics of Pendulum.
+const (
+	pendulumMaxSpeed  = 8.0
+	pendulumMaxTorque = 2.0
+	pendulumDt        = 0.05
+	pendulumGravity   = 10.0
+	pendulumMass      = 1.0
+	pendulumLength    = 1.0
+)
+
+// Reset starts the pendulum at any angle, moving slowly.
+func (p *Pendulum) Reset(rng *rand.Rand) []float32 {
+	p.theta = uniform(rng, -math.Pi, math.Pi)
+	p.thetaDot = uniform(rng, -1, 1)
+	return p.observation()
+}
+
+// Step applies the torque for one step.
+func (p *Pendulum) Step(action []float32) (observation []float32, reward float32, done bool) {
+	torque := clip(float64(action[0]), -pendulumMaxTorque, pendulumMaxTorque)
+	angle := math.Mod(p.theta+math.Pi, 2*math.Pi)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	angle -= math.Pi // the angle from upright, between -pi and pi.
+	cost := angle*angle + 0.1*p.thetaDot*p.thetaDot + 0.001*torque*torque
+	p.thetaDot += (3*pendulumGravity/(2*pendulumLength)*math.Sin(p.theta) + 3/(pendulumMass*pendulumLength*pendulumLength)*torque) * pendulumDt
+	p.thetaDot = clip(p.thetaDot, -pendulumMaxSpeed, pendulumMaxSpeed)
+	p.theta += p.thetaDot * pendulumDt
+	return p.observation(), float32(-cost), false
+}
+
+func (p *Pendulum) observation() []float32 {
+	return []float32{float32(math.Cos(p.theta)), float32(math.Sin(p.theta)), float32(p.thetaDot)}
+}
+
+// ObservationSize is 3: the cosine and sine of the angle, and the angular velocity.
+func (p *Pendulum) ObservationSize() int { return 3 }
+
+// ActionSize is 1: the torque.
+func (p *Pendulum) ActionSize() int { return 1 }
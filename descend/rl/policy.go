@@ -0,0 +1,86 @@
+package rl
+
+import (
+	"errors"
+	"math"
+
+	"github.com/is8ac/tfutils"
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// Policy turns a slice of params into a func which chooses an action for each observation.
+type Policy func(params []*tf.Tensor) (act func(observation []float32) (action []float32), err error)
+
+// LinearPolicy makes the param defs and Policy of a linear map from observations to actions.
+func LinearPolicy(obsSize, actionSize int) (paramDefs []descend.ParamDef, policy Policy) {
+	paramDefs = []descend.ParamDef{
+		descend.ParamDef{Name: "weights", Init: tfutils.Zero(tf.Float, tf.MakeShape(int64(obsSize), int64(actionSize)))},
+		descend.ParamDef{Name: "biases", Init: tfutils.Zero(tf.Float, tf.MakeShape(int64(actionSize)))},
+	}
+	policy = func(params []*tf.Tensor) (act func([]float32) []float32, err error) {
+		if len(params) != 2 {
+			err = errors.New("rl: linear policy needs 2 params")
+			return
+		}
+		weights := params[0].Value().([][]float32)
+		biases := params[1].Value().([]float32)
+		act = func(observation []float32) []float32 {
+			return dense(observation, weights, biases)
+		}
+		return
+	}
+	return
+}
+
+// MLPPolicy makes the param defs and Policy of a neural net with one hidden layer of tanh units.
+// The hidden weights are initialized randomly, as a net of zeros has no gradient for the noise to find.
+func MLPPolicy(obsSize, hiddenSize, actionSize int) (paramDefs []descend.ParamDef, policy Policy) {
+	paramDefs = []descend.ParamDef{
+		descend.ParamDef{Name: "hidden_weights", Init: randomNormal(0.3, int32(obsSize), int32(hiddenSize))},
+		descend.ParamDef{Name: "hidden_biases", Init: tfutils.Zero(tf.Float, tf.MakeShape(int64(hiddenSize)))},
+		descend.ParamDef{Name: "output_weights", Init: tfutils.Zero(tf.Float, tf.MakeShape(int64(hiddenSize), int64(actionSize)))},
+		descend.ParamDef{Name: "output_biases", Init: tfutils.Zero(tf.Float, tf.MakeShape(int64(actionSize)))},
+	}
+	policy = func(params []*tf.Tensor) (act func([]float32) []float32, err error) {
+		if len(params) != 4 {
+			err = errors.New("rl: MLP policy needs 4 params")
+			return
+		}
+		hiddenWeights := params[0].Value().([][]float32)
+		hiddenBiases := params[1].Value().([]float32)
+		outputWeights := params[2].Value().([][]float32)
+		outputBiases := params[3].Value().([]float32)
+		act = func(observation []float32) []float32 {
+			hidden := dense(observation, hiddenWeights, hiddenBiases)
+			for i, value := range hidden {
+				hidden[i] = float32(math.Tanh(float64(value)))
+			}
+			return dense(hidden, outputWeights, outputBiases)
+		}
+		return
+	}
+	return
+}
+
+// randomNormal returns a func which makes normal noise of the given shape, the same every time.
+func randomNormal(stdev float32, dims ...int32) func(*op.Scope) tf.Output {
+	return func(s *op.Scope) tf.Output {
+		seed := op.Const(s.SubScope("seed"), []int64{42, 0})
+		noise := op.StatelessRandomNormal(s, op.Const(s.SubScope("shape"), dims), seed)
+		return op.Mul(s, noise, op.Const(s.SubScope("stdev"), stdev))
+	}
+}
+
+// dense returns input times weights, plus biases.
+func dense(input []float32, weights [][]float32, biases []float32) (output []float32) {
+	output = make([]float32, len(biases))
+	copy(output, biases)
+	for i, value := range input {
+		for j, weight := range weights[i] {
+			output[j] += value * weight
+		}
+	}
+	return
+}
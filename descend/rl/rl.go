@@ -0,0 +1,75 @@
+// Package rl provides reinforcement learning environments written in Go, and the means to search for policies for them with descend.
+// The rollouts run in Go, so the loss is a descend.GoLossFunc, to be used with descend.NewGoLoss.
+package rl
+
+import (
+	"math/rand"
+
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Environment is a task in which an agent observes, acts, and is rewarded.
+type Environment interface {
+	Reset(rng *rand.Rand) (observation []float32)                             // starts a new episode, with the initial state drawn from rng.
+	Step(action []float32) (observation []float32, reward float32, done bool) // acts, and returns what happened.
+	ObservationSize() int                                                     // the length of each observation.
+	ActionSize() int                                                          // the length of each action.
+}
+
+// Rollout runs one episode of env, starting from a state drawn from rng, for at most maxSteps steps, and returns the sum of the rewards.
+func Rollout(env Environment, act func(observation []float32) (action []float32), rng *rand.Rand, maxSteps int) (episodeReturn float32) {
+	observation := env.Reset(rng)
+	for i := 0; i < maxSteps; i++ {
+		var reward float32
+		var done bool
+		observation, reward, done = env.Step(act(observation))
+		episodeReturn += reward
+		if done {
+			return
+		}
+	}
+	return
+}
+
+// MakeRolloutLoss makes a loss which runs policy on episodes episodes of the environment made by makeEnv, and returns the negative of the mean return.
+// The episodes start from the same states every time, as drawn from seed, so that the seeds of a generation are compared fairly.
+func MakeRolloutLoss(makeEnv func() Environment, policy Policy, episodes, maxSteps int, seed int64) descend.GoLossFunc {
+	return func(params []*tf.Tensor) (loss float32, err error) {
+		act, err := policy(params)
+		if err != nil {
+			return
+		}
+		rng := rand.New(rand.NewSource(seed))
+		for i := 0; i < episodes; i++ {
+			loss -= Rollout(makeEnv(), act, rng, maxSteps) / float32(episodes)
+		}
+		return
+	}
+}
+
+// argmax returns the index of the largest value.
+func argmax(values []float32) (index int) {
+	for i, value := range values {
+		if value > values[index] {
+			index = i
+		}
+	}
+	return
+}
+
+// clip limits value to between min and max.
+func clip(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// uniform returns a random number between min and max.
+func uniform(rng *rand.Rand, min, max float64) float64 {
+	return min + rng.Float64()*(max-min)
+}
@@ -0,0 +1,112 @@
+package rl
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/is8ac/tfutils/descend"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// meanReturn is the mean return of act over a few episodes.
+func meanReturn(env Environment, act func([]float32) []float32, maxSteps int) (mean float32) {
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 10; i++ {
+		mean += Rollout(env, act, rng, maxSteps) / 10
+	}
+	return
+}
+
+func TestCartPole(t *testing.T) {
+	alwaysRight := meanReturn(&CartPole{}, func([]float32) []float32 { return []float32{0, 1} }, 500)
+	if alwaysRight > 50 {
+		t.Fatal("pole did not fall when always pushed right", alwaysRight)
+	}
+	// push the cart under the pole.
+	balance := meanReturn(&CartPole{}, func(observation []float32) []float32 { return []float32{0, observation[2] + observation[3]} }, 500)
+	if balance <= alwaysRight*2 {
+		t.Fatal("balancing did not help", balance, alwaysRight)
+	}
+}
+
+func TestPendulum(t *testing.T) {
+	env := &Pendulum{}
+	observation := env.Reset(rand.New(rand.NewSource(0)))
+	for i := 0; i < 100; i++ {
+		var reward float32
+		observation, reward, _ = env.Step([]float32{100}) // clipped to 2.
+		if reward > 0 || reward < -(math.Pi*math.Pi+0.1*8*8+0.001*2*2) {
+			t.Fatal("reward out of range", reward)
+		}
+		norm := observation[0]*observation[0] + observation[1]*observation[1]
+		if norm < 0.999 || norm > 1.001 {
+			t.Fatal("observation is not a cosine and sine", observation)
+		}
+		if observation[2] > 8 || observation[2] < -8 {
+			t.Fatal("speed was not clipped", observation[2])
+		}
+	}
+}
+
+func TestMountainCar(t *testing.T) {
+	idle := meanReturn(&MountainCar{}, func([]float32) []float32 { return []float32{0, 1, 0} }, 200)
+	if idle != -200 {
+		t.Fatal("car reached the flag without pushing", idle)
+	}
+	// push in the direction the car is moving, to rock it higher each time.
+	rock := meanReturn(&MountainCar{}, func(observation []float32) []float32 { return []float32{-observation[1], 0, observation[1]} }, 200)
+	if rock <= -200 {
+		t.Fatal("car did not reach the flag by rocking", rock)
+	}
+}
+
+func TestPolicySearch(t *testing.T) {
+	env := &CartPole{}
+	s := op.NewScope()
+	paramDefs, policy := LinearPolicy(env.ObservationSize(), env.ActionSize())
+	lossFunc, goLoss := descend.NewGoLoss()
+	makeSM, newSeedWeights, _, params := descend.NewWeightedSeedSM(s.SubScope("sm"), descend.MakeNoise(0.1), paramDefs, 20)
+	graph := descend.FitnessGraph{}
+	newSeedWeights(lossFunc, op.Const(s.SubScope("seed_weight"), float32(1)), descend.ExportFitnessGraph(&graph), descend.WithFitnessShaping(descend.CenteredRanks))
+	finalized, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(finalized, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := makeSM(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolloutLoss := MakeRolloutLoss(func() Environment { return &CartPole{} }, policy, 5, 500, 0)
+	seedWeights := goLoss.MakeSeedWeights(sess, graph, rolloutLoss)
+	readLoss := func() float32 {
+		tensors, err := sess.Run(nil, params, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loss, err := rolloutLoss(tensors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loss
+	}
+	initialLoss := readLoss()
+	for i := 0; i < 30; i++ {
+		weights, err := seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if readLoss() >= initialLoss*2 { // the loss is the negative of the return, so it should have doubled in size.
+		t.Fatal("return did not improve", -initialLoss, -readLoss())
+	}
+}
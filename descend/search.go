@@ -0,0 +1,212 @@
+package descend
+
+import (
+	"math"
+	"math/rand"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// TemperatureSchedule returns the temperature of simulated annealing for the given proposal, counting from 1.
+// The sigma schedules can be used as temperature schedules, for example TemperatureSchedule(ExponentialDecay(1, 0.99, 0)).
+type TemperatureSchedule func(proposal int64) float32
+
+// AcceptanceStats counts what a LocalSearch did with the steps it proposed.
+type AcceptanceStats struct {
+	Proposed int64 // how many seeds were stepped and evaluated.
+	Accepted int64 // how many steps were kept. The rest were rewound.
+	Improved int64 // how many of the accepted steps reduced the loss.
+	Uphill   int64 // how many of the accepted steps increased the loss. Always 0 for hill climbing.
+}
+
+// AcceptanceRate is the fraction of the proposed steps which were accepted.
+func (a AcceptanceStats) AcceptanceRate() float32 {
+	if a.Proposed == 0 {
+		return 0
+	}
+	return float32(a.Accepted) / float32(a.Proposed)
+}
+
+// LocalSearch searches greedily with a SeedSM: it steps by a random seed, evaluates the loss, and rewinds the step if it is rejected.
+// Unlike newBestSeed, it evaluates one seed per step, by running a loss tf.Output, so the loss can be anything which can be run, even with a different minibatch each time.
+// It steps and rewinds the SeedSM itself; it must not be stepped by anything else.
+// The SeedSM can be saved at any time, as Save replays away the rounding error of the rejected steps.
+type LocalSearch struct {
+	Stats      AcceptanceStats
+	Loss       float32   // the loss of the current params.
+	BestLoss   float32   // the lowest loss seen.
+	BestSeeds  []int64   // the seeds of the params with the lowest loss.
+	bestSigmas []float32 // the sigmas of BestSeeds.
+	sm         *SeedSM
+	loss       tf.Output
+	schedule   TemperatureSchedule
+	rng        *rand.Rand
+	rewound    int // rejected steps since the params were last replayed.
+}
+
+// resyncInterval is how many rejected steps a LocalSearch takes before it replays its lineage.
+// Rewinding subtracts the noise which stepping added, which in float32 need not give back exactly the same params, so the error would otherwise grow.
+const resyncInterval = 100
+
+// NewHillClimbing makes a LocalSearch which accepts a step only if it does not make the loss of sm worse.
+// loss must be computed from the params of sm. If rng is nil, one seeded with 0 is used.
+func NewHillClimbing(sm *SeedSM, loss tf.Output, rng *rand.Rand) (ls LocalSearch, err error) {
+	return newLocalSearch(sm, loss, nil, rng)
+}
+
+// NewSimulatedAnnealing makes a LocalSearch which also accepts a step which makes the loss worse by delta, with probability exp(-delta/temperature).
+// While the temperature is high it wanders out of local minima; as it cools it becomes hill climbing.
+func NewSimulatedAnnealing(sm *SeedSM, loss tf.Output, schedule TemperatureSchedule, rng *rand.Rand) (ls LocalSearch, err error) {
+	return newLocalSearch(sm, loss, schedule, rng)
+}
+
+func newLocalSearch(sm *SeedSM, loss tf.Output, schedule TemperatureSchedule, rng *rand.Rand) (ls LocalSearch, err error) {
+	if rng == nil {
+		rng = rand.New(rand.NewSource(0))
+	}
+	ls = LocalSearch{sm: sm, loss: loss, schedule: schedule, rng: rng}
+	ls.Loss, err = ls.evalLoss()
+	if err != nil {
+		return
+	}
+	ls.setBest()
+	return
+}
+
+// evalLoss runs the loss of the current params.
+func (ls *LocalSearch) evalLoss() (loss float32, err error) {
+	results, err := ls.sm.sess.Run(nil, []tf.Output{ls.loss}, nil)
+	if err != nil {
+		return
+	}
+	loss = results[0].Value().(float32)
+	return
+}
+
+// setBest records the current params as the best.
+func (ls *LocalSearch) setBest() {
+	ls.BestLoss = ls.Loss
+	ls.BestSeeds = append([]int64{}, ls.sm.Seeds...)
+	ls.bestSigmas = append([]float32{}, ls.sm.Sigmas...)
+}
+
+// accept returns true if a step which changed the loss by delta should be kept.
+func (ls *LocalSearch) accept(delta float32) bool {
+	if delta <= 0 {
+		return true
+	}
+	if ls.schedule == nil {
+		return false
+	}
+	temperature := ls.schedule(ls.Stats.Proposed)
+	if temperature <= 0 {
+		return false
+	}
+	return ls.rng.Float64() < math.Exp(-float64(delta)/float64(temperature))
+}
+
+// Step proposes a step by a random seed, and keeps it or rewinds it. accepted is true if it was kept.
+func (ls *LocalSearch) Step() (accepted bool, err error) {
+	ls.Stats.Proposed++
+	err = ls.sm.Step(ls.rng.Int63())
+	if err != nil {
+		return
+	}
+	loss, err := ls.evalLoss()
+	if err != nil {
+		ls.sm.Rewind() // so that the params are still those of Loss.
+		return
+	}
+	delta := loss - ls.Loss
+	if !ls.accept(delta) {
+		err = ls.reject()
+		return
+	}
+	accepted = true
+	ls.Stats.Accepted++
+	if delta < 0 {
+		ls.Stats.Improved++
+	}
+	if delta > 0 {
+		ls.Stats.Uphill++
+	}
+	ls.Loss = loss
+	if loss < ls.BestLoss {
+		ls.setBest()
+	}
+	return
+}
+
+// reject rewinds the last step, and every resyncInterval rejections, replays the lineage to remove the rounding error of the rewinds.
+func (ls *LocalSearch) reject() (err error) {
+	err = ls.sm.Rewind()
+	if err != nil {
+		return
+	}
+	ls.rewound++
+	if ls.rewound < resyncInterval {
+		return
+	}
+	ls.rewound = 0
+	err = ls.sm.resync() // does nothing if a Save has already replayed the params.
+	if err != nil {
+		return
+	}
+	ls.Loss, err = ls.evalLoss()
+	return
+}
+
+// Run proposes n steps, and returns the stats of just those steps.
+func (ls *LocalSearch) Run(n int64) (stats AcceptanceStats, err error) {
+	start := ls.Stats
+	for i := int64(0); i < n; i++ {
+		_, err = ls.Step()
+		if err != nil {
+			return
+		}
+	}
+	stats = AcceptanceStats{
+		Proposed: ls.Stats.Proposed - start.Proposed,
+		Accepted: ls.Stats.Accepted - start.Accepted,
+		Improved: ls.Stats.Improved - start.Improved,
+		Uphill:   ls.Stats.Uphill - start.Uphill,
+	}
+	return
+}
+
+// RestoreBest resets the params of sm to those with the lowest loss seen, by replaying BestSeeds.
+// Simulated annealing may have accepted steps uphill since, so call it at the end of a run.
+func (ls *LocalSearch) RestoreBest() (err error) {
+	err = ls.sm.replay(ls.BestSeeds, ls.bestSigmas, ls.sm.Sigma)
+	if err != nil {
+		return
+	}
+	ls.Loss, err = ls.evalLoss()
+	return
+}
+
+type localSearchOptimizer struct {
+	*LocalSearch
+}
+
+// NewLocalSearchOptimizer makes an Optimizer of ls. Each step is one proposal, so its generation counts the rejected steps too.
+func NewLocalSearchOptimizer(ls *LocalSearch) Optimizer {
+	return localSearchOptimizer{LocalSearch: ls}
+}
+
+func (o localSearchOptimizer) Step() (err error) {
+	_, err = o.LocalSearch.Step()
+	return
+}
+
+func (o localSearchOptimizer) Generation() int64 {
+	return o.Stats.Proposed
+}
+
+func (o localSearchOptimizer) Params() ([]*tf.Tensor, error) {
+	return o.sm.sess.Run(nil, o.sm.params, nil)
+}
+
+func (o localSearchOptimizer) Close() error {
+	return o.sm.sess.Close()
+}
@@ -0,0 +1,140 @@
+package descend
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// checkLoss fails if the loss of the params of ls is not ls.Loss.
+func checkLoss(t *testing.T, ls *LocalSearch) {
+	actual, err := ls.evalLoss()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rewinds need not restore the params exactly, so allow for rounding.
+	if diff := actual - ls.Loss; diff > 1e-4*(1+ls.Loss) || diff < -1e-4*(1+ls.Loss) {
+		t.Fatal("the loss of the params is", actual, "but the search thinks it is", ls.Loss)
+	}
+}
+
+func TestHillClimbing(t *testing.T) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	ls, err := NewHillClimbing(&sm, ts.loss, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Loss != 30 {
+		t.Fatal("initial loss should be 30, got", ls.Loss)
+	}
+	lastLoss := ls.Loss
+	for i := 0; i < 300; i++ {
+		accepted, err := ls.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ls.Loss > lastLoss {
+			t.Fatal("hill climbing accepted a worse step")
+		}
+		if accepted != (sm.Generation == ls.Stats.Accepted) {
+			t.Fatal("generation of the state machine does not match the accepted steps")
+		}
+		lastLoss = ls.Loss
+		checkLoss(t, &ls)
+	}
+	if ls.Stats.Proposed != 300 || ls.Stats.Uphill != 0 || ls.Stats.Accepted != int64(len(sm.Seeds)) {
+		t.Fatal("bad stats", ls.Stats)
+	}
+	if rate := ls.Stats.AcceptanceRate(); rate <= 0 || rate >= 1 {
+		t.Fatal("acceptance rate should be between 0 and 1, got", rate)
+	}
+	if ls.Loss > 1 {
+		t.Fatal("loss is still", ls.Loss)
+	}
+}
+
+func TestSimulatedAnnealing(t *testing.T) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	ls, err := NewSimulatedAnnealing(&sm, ts.loss, TemperatureSchedule(LinearAnneal(10, 0, 200)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ls.Run(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Uphill == 0 {
+		t.Fatal("a hot anneal should accept some steps uphill")
+	}
+	checkLoss(t, &ls)
+	stats, err = ls.Run(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Proposed != 200 || ls.Stats.Proposed != 300 {
+		t.Fatal("bad stats", stats, ls.Stats)
+	}
+	if ls.BestLoss > 1 {
+		t.Fatal("best loss is still", ls.BestLoss)
+	}
+	err = ls.RestoreBest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := ls.Loss - ls.BestLoss; diff > 1e-4 || diff < -1e-4 || !reflect.DeepEqual(sm.Seeds, ls.BestSeeds) {
+		t.Fatal("did not restore the best params", ls.Loss, ls.BestLoss)
+	}
+	checkLoss(t, &ls)
+}
+
+// With a temperature of 0, simulated annealing is hill climbing.
+func TestColdAnnealing(t *testing.T) {
+	sm1, ts1 := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	hc, err := NewHillClimbing(&sm1, ts1.loss, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2, ts2 := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	sa, err := NewSimulatedAnnealing(&sm2, ts2.loss, func(int64) float32 { return 0 }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ls := range []*LocalSearch{&hc, &sa} {
+		_, err = ls.Run(50)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(hc.Stats, sa.Stats) || !reflect.DeepEqual(sm1.Seeds, sm2.Seeds) {
+		t.Fatal("cold annealing is not hill climbing", hc.Stats, sa.Stats)
+	}
+}
+
+// Rejected steps leave rounding error in the params until they are replayed, so a checkpoint saved after one must still load.
+func TestLocalSearchCheckpoint(t *testing.T) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	ls, err := NewHillClimbing(&sm, ts.loss, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for accepted := true; accepted || sm.Generation == 0; {
+		accepted, err = ls.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.Buffer{}
+	err = sm.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLoss(t, &ls)
+	sm2, ts2 := newTestSeedSM(t, withNoise(MakeNoise(0.1)), withNumSeeds(1))
+	err = sm2.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readParams(t, ts.sess, ts.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("params are different")
+	}
+}
@@ -0,0 +1,69 @@
+package descend
+
+import (
+	"hash/fnv"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// SeedScheme is the way in which the seed of each param tensor is derived from the seed of a step.
+// The generation is given to the noise func separately, so the scheme need only keep params apart.
+// It is part of the lineage, so a checkpoint can only be loaded by a state machine with the same scheme.
+type SeedScheme int
+
+const (
+	// LegacySeeds adds the index of the param to the seed.
+	// Seed 1 on param 0 then makes the same noise as seed 0 on param 1, so the noise of different params is correlated.
+	// Checkpoints saved before there were schemes used it.
+	LegacySeeds SeedScheme = iota
+	// HashedSeeds mixes the seed with a hash of the name of the param, so no two params share noise. It is the default.
+	HashedSeeds
+)
+
+// WithSeedScheme sets the scheme with which the state machine derives the seed of each param.
+// Use LegacySeeds to replay lineages saved before HashedSeeds was the default.
+func WithSeedScheme(scheme SeedScheme) SMOption {
+	return func(c *smConfig) {
+		c.seedScheme = scheme
+	}
+}
+
+// The multipliers of the splitmix64 finalizer, as int64.
+const (
+	mixMul1 = -4658895280553007687 // 0xbf58476d1ce4e5b9
+	mixMul2 = -7723592293110705685 // 0x94d049bb133111eb
+)
+
+// shiftRight shifts x right by n without extending the sign, as TF only has an arithmetic shift.
+func shiftRight(s *op.Scope, x tf.Output, n uint) tf.Output {
+	shifted := op.RightShift(s, x, op.Const(s.SubScope("shift"), int64(n)))
+	return op.BitwiseAnd(s, shifted, op.Const(s.SubScope("mask"), int64(^uint64(0)>>n)))
+}
+
+// mixSeed is the splitmix64 finalizer. Seeds which differ by a single bit give unrelated outputs.
+func mixSeed(s *op.Scope, x tf.Output) tf.Output {
+	x = op.BitwiseXor(s, x, shiftRight(s.SubScope("shift1"), x, 30))
+	x = op.Mul(s, x, op.Const(s.SubScope("mul1"), int64(mixMul1)))
+	x = op.BitwiseXor(s, x, shiftRight(s.SubScope("shift2"), x, 27))
+	x = op.Mul(s, x, op.Const(s.SubScope("mul2"), int64(mixMul2)))
+	return op.BitwiseXor(s, x, shiftRight(s.SubScope("shift3"), x, 31))
+}
+
+// nameKey hashes the name of a param.
+func nameKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// paramSeed derives the seed of the param with the given index and name from the seed of a step.
+func paramSeed(s *op.Scope, scheme SeedScheme, seed tf.Output, index int, name string) tf.Output {
+	if scheme == LegacySeeds {
+		// we sum the seed with the index of the parameter tensor as a hack to prevent two parameter tensors of the same shape from being the same.
+		return op.Add(s.SubScope("inc_seed"), seed, op.Const(s.SubScope("param_index"), int64(index)))
+	}
+	s = s.SubScope("hash_seed")
+	key := op.Const(s.SubScope("name_key"), nameKey(name))
+	return mixSeed(s.SubScope("mix2"), op.BitwiseXor(s, mixSeed(s.SubScope("mix1"), seed), key))
+}
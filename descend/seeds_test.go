@@ -0,0 +1,67 @@
+package descend
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// paramNoises returns the noise of seed 1 on the first param, and of seed 0 on the second.
+func paramNoises(t *testing.T, scheme SeedScheme) (first, second []float32) {
+	s := op.NewScope()
+	noise := MakeNoise(1)
+	shape := op.Const(s.SubScope("shape"), []int32{8})
+	gen := op.Const(s.SubScope("gen"), int64(1))
+	firstNoise := noise(s.SubScope("first"), shape, paramSeed(s.SubScope("first"), scheme, op.Const(s.SubScope("seed_1"), int64(1)), 0, "foo"), gen)
+	secondNoise := noise(s.SubScope("second"), shape, paramSeed(s.SubScope("second"), scheme, op.Const(s.SubScope("seed_0"), int64(0)), 1, "bar"), gen)
+	sess, _ := newTestSession(t, s)
+	results, err := sess.Run(nil, []tf.Output{firstNoise, secondNoise}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results[0].Value().([]float32), results[1].Value().([]float32)
+}
+
+func TestSeedSchemes(t *testing.T) {
+	first, second := paramNoises(t, LegacySeeds)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("legacy seeds should collide", first, second)
+	}
+	first, second = paramNoises(t, HashedSeeds)
+	if reflect.DeepEqual(first, second) {
+		t.Fatal("hashed seeds collide", first, second)
+	}
+}
+
+func TestLegacySeedsCheckpoint(t *testing.T) {
+	noise := MakeNoise(0.003)
+	sm1, ts1 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withSMOptions(WithSeedScheme(LegacySeeds)))
+	for _, seed := range []int64{3, 1, 4} {
+		err := sm1.Step(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.Buffer{}
+	err := sm1.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+	sm2, ts2 := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withSMOptions(WithSeedScheme(LegacySeeds)))
+	err = sm2.Load(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("params differ after load")
+	}
+	sm3, _ := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise)) // hashed seeds by default.
+	err = sm3.Load(bytes.NewReader(saved))
+	if err == nil {
+		t.Fatal("expected an error for a checkpoint with a different seed scheme")
+	}
+}
@@ -0,0 +1,72 @@
+package descend
+
+import (
+	"math"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// FitnessShaping takes a vector of the fitness of n seeds, where higher is better, and returns a vector of n values to weight them by.
+type FitnessShaping func(s *op.Scope, fitness tf.Output, n int) tf.Output
+
+// WithFitnessShaping makes newSeedWeights shape the fitness of the seeds before they are scaled by the seed weight.
+// The default is RawFitness.
+func WithFitnessShaping(shaping FitnessShaping) SeedWeightsOption {
+	return func(c *seedWeightsConfig) {
+		c.shaping = shaping
+	}
+}
+
+// RawFitness leaves the fitness unchanged.
+func RawFitness(s *op.Scope, fitness tf.Output, n int) tf.Output {
+	return fitness
+}
+
+// ranks returns the rank of each fitness, 0 being the fittest.
+func ranks(s *op.Scope, fitness tf.Output, n int) tf.Output {
+	_, indices := op.TopKV2(s, fitness, op.Const(s.SubScope("k"), int32(n)))
+	return op.InvertPermutation(s, indices)
+}
+
+// CenteredRanks replaces each fitness with its rank, scaled to lie evenly between 0.5 for the fittest and -0.5 for the least fit.
+// Only the order of the fitnesses matters, so one outlier can not dominate a step.
+func CenteredRanks(s *op.Scope, fitness tf.Output, n int) tf.Output {
+	if n < 2 {
+		return op.ZerosLike(s, fitness)
+	}
+	rank := op.Cast(s, ranks(s.SubScope("ranks"), fitness, n), tf.Float)
+	scaled := op.Div(s, rank, op.Const(s.SubScope("max_rank"), float32(n-1)))
+	return op.Sub(s, op.Const(s.SubScope("half"), float32(0.5)), scaled)
+}
+
+// nesUtilities returns the utility of each rank, as used by NES.
+func nesUtilities(n int) (utilities []float32) {
+	raw := make([]float64, n)
+	var sum float64
+	for i := range raw {
+		raw[i] = math.Max(0, math.Log(float64(n)/2+1)-math.Log(float64(i+1)))
+		sum += raw[i]
+	}
+	utilities = make([]float32, n)
+	for i := range raw {
+		utilities[i] = float32(raw[i]/sum - 1/float64(n))
+	}
+	return
+}
+
+// NESUtilities replaces each fitness with the NES utility of its rank.
+// The fittest half of the seeds get positive weights which fall off logarithmically, and the rest get the same small negative weight.
+func NESUtilities(s *op.Scope, fitness tf.Output, n int) tf.Output {
+	utilities := op.Const(s.SubScope("utilities"), nesUtilities(n))
+	return op.Gather(s, utilities, ranks(s.SubScope("ranks"), fitness, n))
+}
+
+// ZScore normalizes the fitness to have a mean of 0 and a standard deviation of 1.
+func ZScore(s *op.Scope, fitness tf.Output, n int) tf.Output {
+	dims := op.Const(s.SubScope("dims"), []int32{0})
+	centered := op.Sub(s, fitness, op.Mean(s.SubScope("mean"), fitness, dims))
+	stdev := op.Sqrt(s, op.Mean(s.SubScope("variance"), op.Square(s, centered), dims))
+	epsilon := op.Const(s.SubScope("epsilon"), float32(1e-8)) // so that all equal fitnesses don't give NaNs.
+	return op.Div(s, centered, op.Add(s, stdev, epsilon))
+}
@@ -0,0 +1,77 @@
+package descend
+
+import (
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+func runShaping(t *testing.T, shaping FitnessShaping, fitness []float32) []float32 {
+	s := op.NewScope()
+	shaped := shaping(s.SubScope("shaping"), op.Const(s.SubScope("fitness"), fitness), len(fitness))
+	graph, err := s.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := tf.NewSession(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := sess.Run(nil, []tf.Output{shaped}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results[0].Value().([]float32)
+}
+
+var shapingFitness = []float32{3, -10, 1, 100}
+
+func TestCenteredRanks(t *testing.T) {
+	shaped := runShaping(t, CenteredRanks, shapingFitness)
+	expected := []float32{0.5 - 1.0/3.0, -0.5, 0.5 - 2.0/3.0, 0.5}
+	if !paramsClose(shaped, expected) {
+		t.Fatal("expected", expected, "got", shaped)
+	}
+}
+
+func TestNESUtilities(t *testing.T) {
+	shaped := runShaping(t, NESUtilities, shapingFitness)
+	utilities := nesUtilities(len(shapingFitness))
+	expected := []float32{utilities[1], utilities[3], utilities[2], utilities[0]}
+	var sum float32
+	for i := range expected {
+		if !paramsClose(shaped[i], expected[i]) {
+			t.Fatal("expected", expected, "got", shaped)
+		}
+		sum += shaped[i]
+	}
+	if !paramsClose(sum, float32(0)) {
+		t.Fatal("utilities should sum to 0, sum to", sum)
+	}
+	if shaped[3] <= shaped[0] {
+		t.Fatal("fittest seed should have the highest utility", shaped)
+	}
+}
+
+func TestZScore(t *testing.T) {
+	shaped := runShaping(t, ZScore, shapingFitness)
+	var sum, sumSqr float32
+	for _, v := range shaped {
+		sum += v
+		sumSqr += v * v
+	}
+	n := float32(len(shaped))
+	if !paramsClose(sum/n, float32(0)) || !paramsClose(sumSqr/n, float32(1)) {
+		t.Fatal("z-scores should have mean 0 and variance 1", shaped)
+	}
+}
+
+func TestRawFitness(t *testing.T) {
+	shaped := runShaping(t, RawFitness, shapingFitness)
+	for i := range shapingFitness {
+		if shaped[i] != shapingFitness[i] {
+			t.Fatal("expected", shapingFitness, "got", shaped)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package descend
+
+import "math"
+
+// WithSigma sets the sigma with which the state machine starts. The default is 1.
+// Sigma scales the noise made by the NoiseFunc. Unlike the stdev given to MakeNoise, it is kept in a variable, so it can change during a run.
+// The sigma used by each step is part of the lineage, so Rewind and Load reproduce the same params.
+func WithSigma(sigma float32) SMOption {
+	return func(c *smConfig) {
+		c.sigma = sigma
+	}
+}
+
+// SigmaSchedule returns the sigma to use for the step to the given generation.
+type SigmaSchedule func(generation int64) float32
+
+// WithSigmaSchedule makes the state machine set its sigma from the schedule before each step.
+func WithSigmaSchedule(schedule SigmaSchedule) SMOption {
+	return func(c *smConfig) {
+		c.schedule = schedule
+	}
+}
+
+// ExponentialDecay multiplies sigma by decay each generation, but never lets it fall below min.
+func ExponentialDecay(initial, decay, min float32) SigmaSchedule {
+	return func(generation int64) float32 {
+		sigma := float32(float64(initial) * math.Pow(float64(decay), float64(generation-1)))
+		if sigma < min {
+			return min
+		}
+		return sigma
+	}
+}
+
+// LinearAnneal moves sigma linearly from initial at generation 1 to final at the given generation, and holds it there after.
+func LinearAnneal(initial, final float32, generations int64) SigmaSchedule {
+	return func(generation int64) float32 {
+		if generation >= generations {
+			return final
+		}
+		progress := float32(generation-1) / float32(generations-1)
+		return initial + (final-initial)*progress
+	}
+}
+
+// OneFifthRule adapts sigma with Rechenberg's 1/5th success rule.
+// If more than a fifth of the steps in a window reduced the loss, sigma is increased, otherwise it is decreased.
+// The counts of the current window are not part of the lineage or of checkpoints, so call Reset after Load, and the window restarts empty.
+// To resume exactly as if the run had not stopped, save only at the end of a window, when Pending returns 0.
+type OneFifthRule struct {
+	Window    int     // the number of steps between changes to sigma.
+	Factor    float32 // how much sigma is multiplied or divided by. Should be greater than 1.
+	successes int
+	steps     int
+}
+
+// Observe records whether a step was a success, and returns the new sigma.
+func (r *OneFifthRule) Observe(sigma float32, success bool) float32 {
+	r.steps++
+	if success {
+		r.successes++
+	}
+	if r.steps < r.Window {
+		return sigma
+	}
+	rate := float32(r.successes) / float32(r.steps)
+	r.successes, r.steps = 0, 0
+	if rate > 0.2 {
+		return sigma * r.Factor
+	}
+	if rate < 0.2 {
+		return sigma / r.Factor
+	}
+	return sigma
+}
+
+// Pending returns how many steps have been observed in the current window.
+func (r *OneFifthRule) Pending() int {
+	return r.steps
+}
+
+// Reset empties the current window, for when the state machine is loaded from a checkpoint.
+func (r *OneFifthRule) Reset() {
+	r.successes, r.steps = 0, 0
+}
+
+// AdaptSigma observes whether the last step was a success, and sets the sigma of the state machine according to the rule.
+func (sm *SeedSM) AdaptSigma(rule *OneFifthRule, success bool) error {
+	return sm.SetSigma(rule.Observe(sm.Sigma, success))
+}
@@ -0,0 +1,178 @@
+package descend
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func TestOneFifthRule(t *testing.T) {
+	rule := &OneFifthRule{Window: 5, Factor: 2}
+	sigma := float32(1)
+	for i := 0; i < 5; i++ {
+		sigma = rule.Observe(sigma, i < 2) // 2 in 5 succeed
+	}
+	if sigma != 2 {
+		t.Fatal("sigma should have doubled, is", sigma)
+	}
+	for i := 0; i < 5; i++ {
+		sigma = rule.Observe(sigma, false)
+	}
+	if sigma != 1 {
+		t.Fatal("sigma should have halved, is", sigma)
+	}
+	rule.Observe(sigma, true)
+	if rule.Pending() != 1 {
+		t.Fatal("expected 1 pending step, got", rule.Pending())
+	}
+	rule.Reset()
+	if rule.Pending() != 0 {
+		t.Fatal("reset did not empty the window")
+	}
+}
+
+func TestSigmaSchedules(t *testing.T) {
+	decay := ExponentialDecay(1, 0.5, 0.2)
+	if decay(1) != 1 || decay(2) != 0.5 || decay(10) != 0.2 {
+		t.Fatal("bad decay", decay(1), decay(2), decay(10))
+	}
+	anneal := LinearAnneal(1, 0, 11)
+	if anneal(1) != 1 || anneal(6) != 0.5 || anneal(100) != 0 {
+		t.Fatal("bad anneal", anneal(1), anneal(6), anneal(100))
+	}
+}
+
+func TestSeedSMSigmaLineage(t *testing.T) {
+	options := []testOption{withParamDefs(checkpointParamDefs), withNoise(MakeNoise(1)), withSMOptions(WithSigma(0.5))}
+	sm1, ts1 := newTestSeedSM(t, options...)
+	sm2, ts2 := newTestSeedSM(t, options...)
+	err := sm1.Step(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readParams(t, ts1.sess, ts1.params)
+	err = sm1.SetSigma(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.Step(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm1.SetSigma(0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sm1.Sigmas, []float32{0.5, 3}) {
+		t.Fatal("bad sigmas", sm1.Sigmas)
+	}
+	buf := &bytes.Buffer{}
+	err = sm1.Save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.Sigma != 0.1 || !reflect.DeepEqual(readParams(t, ts1.sess, ts1.params), readParams(t, ts2.sess, ts2.params)) {
+		t.Fatal("sigma lineage was not replayed", sm2.Sigma, sm2.Sigmas)
+	}
+	err = sm2.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.Sigma != 3 {
+		t.Fatal("rewind should restore the sigma of the undone step, is", sm2.Sigma)
+	}
+	after := readParams(t, ts2.sess, ts2.params)
+	if !paramsClose(before, after) {
+		t.Fatal("rewind did not undo the step", before, after)
+	}
+}
+
+func TestWeightedSeedSMSigmaSchedule(t *testing.T) {
+	schedule := ExponentialDecay(0.01, 0.9, 0.001)
+	sm, _ := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(MakeNoise(1)), withNumSeeds(2), withSMOptions(WithSigmaSchedule(schedule)))
+	for i := 0; i < 3; i++ {
+		if sm.Sigma != schedule(sm.Generation+1) {
+			t.Fatal("sigma does not follow the schedule", sm.Generation, sm.Sigma)
+		}
+		err := sm.Step([]float32{1, -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(sm.Sigmas, []float32{schedule(1), schedule(2), schedule(3)}) {
+		t.Fatal("bad sigmas", sm.Sigmas)
+	}
+	buf := &bytes.Buffer{}
+	err := sm.Save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.Load(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Sigma != schedule(4) {
+		t.Fatal("sigma was not restored", sm.Sigma)
+	}
+}
+
+func TestOneFifthRuletrain(t *testing.T) {
+	sm, ts := newTestSeedSM(t, withNoise(MakeNoise(1)), withNumSeeds(1), withSMOptions(WithSigma(0.1)))
+	getLoss := func() float32 {
+		results, err := ts.sess.Run(nil, []tf.Output{ts.loss}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0].Value().(float32)
+	}
+	rule := &OneFifthRule{Window: 10, Factor: 1.5}
+	rng := rand.New(rand.NewSource(42))
+	curLoss := getLoss()
+	for i := 0; i < 1000; i++ { // a (1+1)-ES
+		err := sm.Step(rng.Int63())
+		if err != nil {
+			t.Fatal(err)
+		}
+		newLoss := getLoss()
+		success := newLoss < curLoss
+		if success {
+			curLoss = newLoss
+		} else {
+			err = sm.Rewind()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = sm.AdaptSigma(rule, success)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFitted(t, readParams(t, ts.sess, ts.params))
+}
+
+// A checkpoint at generation 0 has no sigmas, but must still resume with its sigma.
+func TestGenerationZeroSigmaCheckpoint(t *testing.T) {
+	noise := MakeNoise(1)
+	sm1, _ := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise), withSMOptions(WithSigma(0.1)))
+	sm2, _ := newTestSeedSM(t, withParamDefs(checkpointParamDefs), withNoise(noise))
+	buf := bytes.Buffer{}
+	err := sm1.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm2.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm2.Sigma != 0.1 {
+		t.Fatal("expected sigma 0.1 after load, got", sm2.Sigma)
+	}
+}
@@ -0,0 +1,112 @@
+package descend
+
+import (
+	"errors"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// ErrStopTraining can be returned by the callbacks of a Trainer to stop training early without an error.
+var ErrStopTraining = errors.New("descend: stop training")
+
+// Trainer steps an Optimizer until it reaches a generation, evaluating it every so often.
+// Only Optimizer and Generations are needed, the rest are optional.
+type Trainer struct {
+	Optimizer    Optimizer
+	Generations  int64                   // train until the optimizer is at this generation.
+	EvalInterval int64                   // evaluate every this many generations. 0 means never.
+	Eval         func() (float32, error) // returns the validation metric, lower is better unless Maximize is set.
+	Maximize     bool                    // higher values of the metric are better, as for accuracy.
+	Patience     int                     // stop if the metric has not improved for this many evaluations. 0 means never stop early.
+	// OnGeneration is called after each step.
+	OnGeneration func(generation int64) error
+	// OnEval is called after each evaluation, with whether the metric is the best so far.
+	OnEval func(generation int64, metric float32, best bool) error
+}
+
+// TrainResult is what a Trainer found.
+type TrainResult struct {
+	Generation     int64        // the generation at which training stopped.
+	BestGeneration int64        // the generation at which the best metric was seen.
+	BestMetric     float32      // the best metric seen.
+	BestParams     []*tf.Tensor // a snapshot of the params at BestGeneration. Nil if there was no evaluation.
+	EarlyStopped   bool         // training stopped before Generations, because of Patience or ErrStopTraining.
+}
+
+// better returns true if a is better than b.
+func (t *Trainer) better(a, b float32) bool {
+	if t.Maximize {
+		return a > b
+	}
+	return a < b
+}
+
+// evaluate runs Eval, and snapshots the params if the metric is the best so far.
+// It returns true if training should stop.
+func (t *Trainer) evaluate(result *TrainResult, sinceBest *int) (stop bool, err error) {
+	metric, err := t.Eval()
+	if err != nil {
+		return
+	}
+	generation := t.Optimizer.Generation()
+	best := result.BestParams == nil || t.better(metric, result.BestMetric)
+	if best {
+		result.BestParams, err = t.Optimizer.Params()
+		if err != nil {
+			return
+		}
+		result.BestGeneration = generation
+		result.BestMetric = metric
+		*sinceBest = 0
+	} else {
+		*sinceBest++
+	}
+	if t.OnEval != nil {
+		err = t.OnEval(generation, metric, best)
+		if err != nil {
+			return
+		}
+	}
+	stop = t.Patience > 0 && *sinceBest >= t.Patience
+	return
+}
+
+// Train steps the optimizer until it reaches Generations, or stops early.
+// It starts from the current generation of the optimizer, so a resumed optimizer is only trained for the generations it has left.
+// Errors from the optimizer or the callbacks stop training, and are returned along with the result so far.
+func (t *Trainer) Train() (result TrainResult, err error) {
+	sinceBest := 0
+	defer func() {
+		result.Generation = t.Optimizer.Generation()
+		if err == ErrStopTraining {
+			result.EarlyStopped = true
+			err = nil
+		}
+	}()
+	for t.Optimizer.Generation() < t.Generations {
+		err = t.Optimizer.Step()
+		if err != nil {
+			return
+		}
+		generation := t.Optimizer.Generation()
+		if t.OnGeneration != nil {
+			err = t.OnGeneration(generation)
+			if err != nil {
+				return
+			}
+		}
+		if t.Eval == nil || t.EvalInterval <= 0 || generation%t.EvalInterval != 0 {
+			continue
+		}
+		var stop bool
+		stop, err = t.evaluate(&result, &sinceBest)
+		if err != nil {
+			return
+		}
+		if stop {
+			result.EarlyStopped = true
+			return
+		}
+	}
+	return
+}
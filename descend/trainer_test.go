@@ -0,0 +1,123 @@
+package descend
+
+import (
+	"errors"
+	"testing"
+)
+
+// optimizerLoss calculates the loss of the params of the optimizers of makeOptimizerLoss in Go.
+func optimizerLoss(opt Optimizer) (loss float32, err error) {
+	paramTensors, err := opt.Params()
+	if err != nil {
+		return
+	}
+	return optimizerGoLoss(paramTensors)
+}
+
+func TestTrainer(t *testing.T) {
+	opt := makeWeightedSeedOptimizer(t)
+	defer opt.Close()
+	generations := 0
+	evals := 0
+	trainer := Trainer{
+		Optimizer:    opt,
+		Generations:  1000,
+		EvalInterval: 50,
+		Eval: func() (float32, error) {
+			return optimizerLoss(opt)
+		},
+		OnGeneration: func(generation int64) error {
+			generations++
+			return nil
+		},
+		OnEval: func(generation int64, metric float32, best bool) error {
+			evals++
+			return nil
+		},
+	}
+	result, err := trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Generation != 1000 || generations != 1000 || evals != 20 {
+		t.Fatal("wrong number of generations or evals", result.Generation, generations, evals)
+	}
+	if result.EarlyStopped {
+		t.Fatal("should not have stopped early")
+	}
+	if result.BestParams == nil || result.BestMetric > 0.1 {
+		t.Fatal("loss is not ~0", result.BestMetric)
+	}
+	// training again does nothing, as the optimizer is already at the last generation.
+	result, err = trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Generation != 1000 || generations != 1000 {
+		t.Fatal("trained past Generations")
+	}
+}
+
+func TestTrainerEarlyStopping(t *testing.T) {
+	opt := makeSeedOptimizer(t)
+	defer opt.Close()
+	metrics := []float32{0.5, 0.7, 0.6, 0.7, 0.4, 0.7}
+	trainer := Trainer{
+		Optimizer:    opt,
+		Generations:  100,
+		EvalInterval: 1,
+		Maximize:     true,
+		Patience:     3,
+		Eval: func() (metric float32, err error) {
+			metric = metrics[0]
+			metrics = metrics[1:]
+			return
+		},
+	}
+	result, err := trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.EarlyStopped || result.Generation != 5 {
+		t.Fatal("should have stopped at generation 5, not", result.Generation)
+	}
+	if result.BestGeneration != 2 || result.BestMetric != 0.7 {
+		t.Fatal("best should be 0.7 at generation 2, not", result.BestMetric, "at", result.BestGeneration)
+	}
+}
+
+func TestTrainerErrors(t *testing.T) {
+	opt := makeSeedOptimizer(t)
+	defer opt.Close()
+	errBoom := errors.New("boom")
+	trainer := Trainer{
+		Optimizer:   opt,
+		Generations: 100,
+		OnGeneration: func(generation int64) error {
+			if generation == 5 {
+				return errBoom
+			}
+			return nil
+		},
+	}
+	result, err := trainer.Train()
+	if err != errBoom {
+		t.Fatal("expected errBoom, got", err)
+	}
+	if result.Generation != 5 {
+		t.Fatal("should have stopped at generation 5, not", result.Generation)
+	}
+	trainer.OnGeneration = func(generation int64) error {
+		if generation == 10 {
+			return ErrStopTraining
+		}
+		return nil
+	}
+	result, err = trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.EarlyStopped || result.Generation != 10 {
+		t.Fatal("should have stopped at generation 10, not", result.Generation)
+	}
+}
@@ -0,0 +1,77 @@
+package descend
+
+import (
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+	"github.com/tensorflow/tensorflow/tensorflow/go/op"
+)
+
+// UpdateRule turns an estimate of the gradient of one param tensor into the update which is to be added to it.
+// name is the shared name of the param. The shared name of each state variable should be name, a "/", and the name of the state, so that it can not be that of a param.
+// The gradient points in the direction which reduces the loss, and gen is the generation being stepped to.
+// like is the initial value of the param, and should be used to give state variables the right shape.
+// A rule may keep state in variables, in which case it must return the ops to update them, and the ops to reset them.
+type UpdateRule func(s *op.Scope, name string, like, grad, gen tf.Output) (update tf.Output, stateUpdates, init []*tf.Operation)
+
+// stateVar makes a variable of the same shape as like, named after the param, and the op to set it to zeros.
+func stateVar(s *op.Scope, name string, like tf.Output) (handle tf.Output, init *tf.Operation) {
+	handle = op.VarHandleOp(s, like.DataType(), like.Shape(), op.VarHandleOpSharedName(name))
+	init = op.AssignVariableOp(s.SubScope("init"), handle, op.ZerosLike(s, like))
+	return
+}
+
+// SGD scales the gradient by the learning rate.
+func SGD(learningRate float32) UpdateRule {
+	return func(s *op.Scope, name string, like, grad, gen tf.Output) (update tf.Output, stateUpdates, init []*tf.Operation) {
+		update = op.Mul(s, grad, op.Const(s.SubScope("learning_rate"), learningRate))
+		return
+	}
+}
+
+// Momentum keeps an exponentially decaying sum of past gradients, and applies it scaled by the learning rate.
+func Momentum(learningRate, beta float32) UpdateRule {
+	return func(s *op.Scope, name string, like, grad, gen tf.Output) (update tf.Output, stateUpdates, init []*tf.Operation) {
+		velocityScope := s.SubScope("velocity")
+		velocity, initVelocity := stateVar(velocityScope, name+"/velocity", like)
+		oldVelocity := op.ReadVariableOp(velocityScope, velocity, like.DataType())
+		newVelocity := op.Add(velocityScope, op.Mul(velocityScope, oldVelocity, op.Const(velocityScope.SubScope("beta"), beta)), grad)
+		stateUpdates = []*tf.Operation{op.AssignVariableOp(velocityScope.SubScope("update"), velocity, newVelocity)}
+		init = []*tf.Operation{initVelocity}
+		update = op.Mul(s, newVelocity, op.Const(s.SubScope("learning_rate"), learningRate))
+		return
+	}
+}
+
+// Adam applies the gradient using the Adam algorithm.
+// The generation is used as the time step for bias correction.
+func Adam(learningRate, beta1, beta2, epsilon float32) UpdateRule {
+	return func(s *op.Scope, name string, like, grad, gen tf.Output) (update tf.Output, stateUpdates, init []*tf.Operation) {
+		step := op.Cast(s.SubScope("step"), gen, tf.Float)
+		// first moment
+		mScope := s.SubScope("m")
+		m, initM := stateVar(mScope, name+"/adam_m", like)
+		b1 := op.Const(mScope.SubScope("beta"), beta1)
+		newM := op.Add(mScope,
+			op.Mul(mScope, op.ReadVariableOp(mScope, m, like.DataType()), b1),
+			op.Mul(mScope.SubScope("grad"), grad, op.Const(mScope.SubScope("one_minus_beta"), 1-beta1)),
+		)
+		mHat := op.Div(mScope, newM, op.Sub(mScope, op.Const(mScope.SubScope("one"), float32(1)), op.Pow(mScope, b1, step)))
+		// second moment
+		vScope := s.SubScope("v")
+		v, initV := stateVar(vScope, name+"/adam_v", like)
+		b2 := op.Const(vScope.SubScope("beta"), beta2)
+		newV := op.Add(vScope,
+			op.Mul(vScope, op.ReadVariableOp(vScope, v, like.DataType()), b2),
+			op.Mul(vScope.SubScope("grad"), op.Square(vScope, grad), op.Const(vScope.SubScope("one_minus_beta"), 1-beta2)),
+		)
+		vHat := op.Div(vScope, newV, op.Sub(vScope, op.Const(vScope.SubScope("one"), float32(1)), op.Pow(vScope, b2, step)))
+
+		stateUpdates = []*tf.Operation{
+			op.AssignVariableOp(mScope.SubScope("update"), m, newM),
+			op.AssignVariableOp(vScope.SubScope("update"), v, newV),
+		}
+		init = []*tf.Operation{initM, initV}
+		denominator := op.Add(s, op.Sqrt(s, vHat), op.Const(s.SubScope("epsilon"), epsilon))
+		update = op.Mul(s, op.Div(s, mHat, denominator), op.Const(s.SubScope("learning_rate"), learningRate))
+		return
+	}
+}
@@ -0,0 +1,62 @@
+package descend
+
+import (
+	"reflect"
+	"testing"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func trainWithUpdateRule(t *testing.T, rule UpdateRule) {
+	sm, ts := newTestWeightedSeedSM(t, withSMOptions(WithUpdateRule(rule)))
+	for i := 0; i < 1000; i++ {
+		weights, err := ts.seedWeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sm.Step(weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFitted(t, readParams(t, ts.sess, ts.params))
+}
+
+func TestMomentumtrain(t *testing.T) {
+	trainWithUpdateRule(t, Momentum(0.1, 0.9))
+}
+
+func TestAdamtrain(t *testing.T) {
+	trainWithUpdateRule(t, Adam(0.01, 0.9, 0.999, 1e-8))
+}
+
+func TestAdamRewind(t *testing.T) {
+	sm, ts := newTestWeightedSeedSM(t, withParamDefs(checkpointParamDefs), withNumSeeds(2), withSMOptions(WithUpdateRule(Adam(0.01, 0.9, 0.999, 1e-8))))
+	err := sm.Step([]float32{0.2, 0.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.Step([]float32{-0.5, 0.3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readParams(t, ts.sess, ts.params)
+	err = sm.Step([]float32{3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.Rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, readParams(t, ts.sess, ts.params)) {
+		t.Fatal("params are different after rewind")
+	}
+	results, err := ts.sess.Run(nil, []tf.Output{ts.generation}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Value().(int64) != 2 || sm.Generation != 2 {
+		t.Fatal("generation was not rewound", results[0].Value(), sm.Generation)
+	}
+}
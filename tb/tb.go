@@ -86,3 +86,69 @@ func MakePlusMinusOneImageLogOP(data tf.Output, name string) LogOP {
 		},
 	}
 }
+
+// ScalarWriter writes scalars to a TensorBoard log dir from Go, without needing any summary OPs in the graph being logged.
+type ScalarWriter struct {
+	sess    *tf.Session
+	tag     tf.Output
+	step    tf.Output
+	value   tf.Output
+	write   *tf.Operation
+	closeOP *tf.Operation
+}
+
+// NewScalarWriter creates a ScalarWriter which logs to logDir.
+func NewScalarWriter(logDir string) (w ScalarWriter, err error) {
+	s := op.NewScope()
+	writer := op.SummaryWriter(s)
+	createSummaryWriter := op.CreateSummaryFileWriter(s,
+		writer,
+		op.Const(s.SubScope("log_dir"), logDir),
+		op.Const(s.SubScope("max_queue"), int32(100)),
+		op.Const(s.SubScope("flush_millis"), int32(1000)),
+		op.Const(s.SubScope("filename_suffix"), ".tblog"),
+	)
+	w.tag = op.Placeholder(s.SubScope("tag"), tf.String, op.PlaceholderShape(tf.ScalarShape()))
+	w.step = op.Placeholder(s.SubScope("step"), tf.Int64, op.PlaceholderShape(tf.ScalarShape()))
+	w.value = op.Placeholder(s.SubScope("value"), tf.Float, op.PlaceholderShape(tf.ScalarShape()))
+	w.write = op.WriteScalarSummary(s, writer, w.step, w.tag, w.value)
+	w.closeOP = op.CloseSummaryWriter(s, writer)
+	graph, err := s.Finalize()
+	if err != nil {
+		return
+	}
+	w.sess, err = tf.NewSession(graph, nil)
+	if err != nil {
+		return
+	}
+	_, err = w.sess.Run(nil, nil, []*tf.Operation{createSummaryWriter})
+	return
+}
+
+// Write logs value with the given tag at step.
+func (w ScalarWriter) Write(tag string, step int64, value float32) (err error) {
+	tagTensor, err := tf.NewTensor(tag)
+	if err != nil {
+		return
+	}
+	stepTensor, err := tf.NewTensor(step)
+	if err != nil {
+		return
+	}
+	valueTensor, err := tf.NewTensor(value)
+	if err != nil {
+		return
+	}
+	_, err = w.sess.Run(map[tf.Output]*tf.Tensor{w.tag: tagTensor, w.step: stepTensor, w.value: valueTensor}, nil, []*tf.Operation{w.write})
+	return
+}
+
+// Close flushes the log and closes the session of the writer.
+func (w ScalarWriter) Close() (err error) {
+	_, err = w.sess.Run(nil, nil, []*tf.Operation{w.closeOP})
+	if err != nil {
+		return
+	}
+	err = w.sess.Close()
+	return
+}